@@ -0,0 +1,246 @@
+package cbor
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+)
+
+const (
+	annotateIndent = 3
+	annotateColumn = 32
+	annotateWidth  = 16
+)
+
+func Annotate(w io.Writer, bs []byte) error {
+	return AnnotateReader(w, bytes.NewReader(bs))
+}
+
+// AnnotateReader writes an annotated hex dump of the data items read from r
+// to w. Each line gives the offset of its first byte, the bytes of a header
+// or of a part of a payload indented by the depth of the item and a comment
+// describing them.
+func AnnotateReader(w io.Writer, r io.Reader) error {
+	a := annotator{
+		w: bufio.NewWriter(w),
+		s: newScanner(r),
+	}
+	for a.s.more() {
+		if err := a.item(0); err != nil {
+			a.w.Flush()
+			return err
+		}
+	}
+	return a.w.Flush()
+}
+
+type annotator struct {
+	w *bufio.Writer
+	s *scanner
+}
+
+func (a *annotator) item(depth int) error {
+	h, err := a.s.header()
+	if err != nil {
+		return err
+	}
+	if h.IsBreak() {
+		return a.s.errorf(h.offset, "unexpected break")
+	}
+	str := headerHex(h)
+	switch h.Major {
+	case Uint:
+		a.line(h.offset, depth, str, fmt.Sprintf("unsigned(%d)", h.Arg))
+	case Int:
+		v := fmt.Sprintf("-%d", h.Arg+1)
+		if h.Arg == math.MaxUint64 {
+			v = "-18446744073709551616"
+		}
+		a.line(h.offset, depth, str, fmt.Sprintf("negative(%s)", v))
+	case Bin, String:
+		a.line(h.offset, depth, str, fmt.Sprintf("%s(%s)", majorName(h.Major), lengthOf(h)))
+		if h.Indefinite() {
+			return a.chunks(h, depth+1)
+		}
+		return a.payload(h, depth+1)
+	case Array, Map:
+		a.line(h.offset, depth, str, fmt.Sprintf("%s(%s)", majorName(h.Major), lengthOf(h)))
+		return a.container(h, depth+1)
+	case Tag:
+		a.line(h.offset, depth, str, fmt.Sprintf("tag(%d)", h.Arg))
+		return a.item(depth + 1)
+	case Other:
+		a.line(h.offset, depth, str, simpleName(h))
+	}
+	return nil
+}
+
+func (a *annotator) container(h header, depth int) error {
+	for i := uint64(0); ; i++ {
+		if h.Indefinite() {
+			off := a.s.off
+			brk, err := a.s.peekBreak()
+			if err != nil {
+				return err
+			}
+			if brk {
+				a.line(off, depth, "ff", "break")
+				return nil
+			}
+		} else if i >= h.Arg {
+			return nil
+		}
+		if err := a.item(depth); err != nil {
+			return err
+		}
+		if h.Major == Map {
+			if err := a.item(depth); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func (a *annotator) chunks(h header, depth int) error {
+	for {
+		c, ok, err := a.s.chunk(h.Major)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			a.line(c.offset, depth, "ff", "break")
+			return nil
+		}
+		a.line(c.offset, depth, headerHex(c), fmt.Sprintf("%s(%d)", majorName(c.Major), c.Arg))
+		if err := a.payload(c, depth+1); err != nil {
+			return err
+		}
+	}
+}
+
+// payload writes the payload of a definite length string by lines of at
+// most annotateWidth bytes. Lines of text strings are cut on UTF-8 sequence
+// boundaries.
+func (a *annotator) payload(h header, depth int) error {
+	var (
+		buf  [annotateWidth]byte
+		keep int
+	)
+	for n := h.Arg; n > 0 || keep > 0; {
+		off := a.s.off - int64(keep)
+		z := len(buf) - keep
+		if uint64(z) > n {
+			z = int(n)
+		}
+		if err := a.s.readFull(buf[keep : keep+z]); err != nil {
+			return err
+		}
+		n -= uint64(z)
+
+		data, end := buf[:keep+z], keep+z
+		if h.Major == String && n > 0 {
+			end = fullRunes(data)
+		}
+		a.prefix(off, depth, hex.EncodeToString(data[:end]))
+		if h.Major == String {
+			a.pad(depth, 2*end)
+			a.w.WriteString("# \"")
+			writeQuoted(a.w, data[:end])
+			a.w.WriteByte('"')
+		}
+		a.w.WriteByte('\n')
+		keep = copy(buf[:], data[end:])
+	}
+	return nil
+}
+
+func (a *annotator) line(off int64, depth int, str, comment string) {
+	a.prefix(off, depth, str)
+	a.pad(depth, len(str))
+	a.w.WriteString("# ")
+	a.w.WriteString(comment)
+	a.w.WriteByte('\n')
+}
+
+// prefix writes the offset and the indented hex bytes of a line.
+func (a *annotator) prefix(off int64, depth int, str string) {
+	fmt.Fprintf(a.w, "%08x  ", off)
+	a.w.WriteString(strings.Repeat(" ", depth*annotateIndent))
+	a.w.WriteString(str)
+}
+
+// pad writes the spaces needed to reach the column of the comments after n
+// characters of hex bytes.
+func (a *annotator) pad(depth, n int) {
+	if z := depth*annotateIndent + n; z < annotateColumn {
+		a.w.WriteString(strings.Repeat(" ", annotateColumn-z))
+	} else {
+		a.w.WriteByte(' ')
+	}
+}
+
+// headerHex returns the hex encoding of the initial byte of h, followed by
+// the one of its argument if any.
+func headerHex(h header) string {
+	var (
+		hdr = appendHeader(nil, h.Major, h.Info, h.Arg)
+		str = hex.EncodeToString(hdr[:1])
+	)
+	if len(hdr) > 1 {
+		str += " " + hex.EncodeToString(hdr[1:])
+	}
+	return str
+}
+
+func lengthOf(h header) string {
+	if h.Indefinite() {
+		return "*"
+	}
+	return fmt.Sprintf("%d", h.Arg)
+}
+
+func majorName(m byte) string {
+	switch m {
+	case Uint:
+		return "unsigned"
+	case Int:
+		return "negative"
+	case Bin:
+		return "bytes"
+	case String:
+		return "text"
+	case Array:
+		return "array"
+	case Map:
+		return "map"
+	case Tag:
+		return "tag"
+	default:
+		return "simple"
+	}
+}
+
+func simpleName(h header) string {
+	switch h.Info {
+	case False:
+		return "false"
+	case True:
+		return "true"
+	case Nil:
+		return "null"
+	case Undefined:
+		return "undefined"
+	case Float16:
+		return fmt.Sprintf("float16(%s)", formatFloat(float16frombits(uint16(h.Arg))))
+	case Float32:
+		return fmt.Sprintf("float32(%s)", formatFloat(float64(math.Float32frombits(uint32(h.Arg)))))
+	case Float64:
+		return fmt.Sprintf("float64(%s)", formatFloat(math.Float64frombits(h.Arg)))
+	default:
+		return fmt.Sprintf("simple(%d)", h.Arg)
+	}
+}
@@ -0,0 +1,77 @@
+package cbor
+
+import (
+	"bytes"
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+func TestAnnotate(t *testing.T) {
+	data := []struct {
+		Raw  string
+		Want []string
+	}{
+		{
+			Raw: "a26161016162820203",
+			Want: []string{
+				"00000000  a2                              # map(2)",
+				"00000001     61                           # text(1)",
+				"00000002        61                        # \"a\"",
+				"00000003     01                           # unsigned(1)",
+				"00000004     61                           # text(1)",
+				"00000005        62                        # \"b\"",
+				"00000006     82                           # array(2)",
+				"00000007        02                        # unsigned(2)",
+				"00000008        03                        # unsigned(3)",
+			},
+		},
+		{
+			Raw: "9f1903e8395f42c11a514b67b0ff",
+			Want: []string{
+				"00000000  9f                              # array(*)",
+				"00000001     19 03e8                      # unsigned(1000)",
+				"00000004     39 5f42                      # negative(-24387)",
+				"00000007     c1                           # tag(1)",
+				"00000008        1a 514b67b0               # unsigned(1363896240)",
+				"0000000d     ff                           # break",
+			},
+		},
+		{
+			Raw: "5f42010240ff",
+			Want: []string{
+				"00000000  5f                              # bytes(*)",
+				"00000001     42                           # bytes(2)",
+				"00000002        0102",
+				"00000004     40                           # bytes(0)",
+				"00000005     ff                           # break",
+			},
+		},
+		{
+			Raw: "736162636465666768696a6b6c6d6ee6b0b47879f93e00f6",
+			Want: []string{
+				"00000000  73                              # text(19)",
+				"00000001     6162636465666768696a6b6c6d6e # \"abcdefghijklmn\"",
+				"0000000f     e6b0b47879                   # \"水xy\"",
+				"00000014  f9 3e00                         # float16(1.5)",
+				"00000017  f6                              # null",
+			},
+		},
+	}
+	for i, d := range data {
+		bs, err := hex.DecodeString(d.Raw)
+		if err != nil {
+			t.Errorf("%d: fail to decode hex string: %s (%s)", i+1, err, d.Raw)
+			continue
+		}
+		var w bytes.Buffer
+		if err := Annotate(&w, bs); err != nil {
+			t.Errorf("%d: failed to annotate %s => %s", i+1, d.Raw, err)
+			continue
+		}
+		want := strings.Join(d.Want, "\n") + "\n"
+		if got := w.String(); got != want {
+			t.Errorf("%d: want\n%s\ngot\n%s", i+1, want, got)
+		}
+	}
+}
@@ -1,18 +1,31 @@
 package cbor
 
 import (
-	"bufio"
-	"bytes"
-	"encoding/binary"
 	"errors"
 	"fmt"
-	"io"
 	"math"
+	"reflect"
+	"strings"
 )
 
 var (
-	ErrTooLarge   = errors.New("cbor: too large")
-	ErrOutOfRange = errors.New("cbor: out of range")
+	ErrTooLarge    = errors.New("cbor: too large")
+	ErrOutOfRange  = errors.New("cbor: out of range")
+	ErrInvalidUTF8 = errors.New("cbor: invalid UTF-8 in text string")
+	ErrNotFound    = errors.New("cbor: not found")
+)
+
+// UTF8Policy defines how text strings that are not valid UTF-8 are handled.
+type UTF8Policy int
+
+const (
+	// UTF8Binary encodes invalid Go strings as byte strings. It is only
+	// meaningful for the Encoder: the Decoder handles it like UTF8Reject.
+	UTF8Binary UTF8Policy = iota
+	// UTF8Reject fails with ErrInvalidUTF8.
+	UTF8Reject
+	// UTF8Replace replaces invalid sequences with U+FFFD.
+	UTF8Replace
 )
 
 type UnsupportedError string
@@ -21,6 +34,175 @@ func (u UnsupportedError) Error() string {
 	return fmt.Sprintf("cbor: unsupported data type %q", string(u))
 }
 
+// SyntaxError describes a malformed or invalid CBOR item and the offset of the
+// byte where the problem was found.
+type SyntaxError struct {
+	msg    string
+	Offset int64
+	// err is the error that caused e, if any
+	err error
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("cbor: %s at offset %d", e.msg, e.Offset)
+}
+
+func (e *SyntaxError) Unwrap() error {
+	return e.err
+}
+
+// The errors returned by a Decoder for values that can not be decoded give
+// the offset of the item in the input and the path of the value from the
+// top-level one, like .items[3].name. The path is empty for the top-level
+// value. Use errors.As to access them.
+
+// UnmarshalTypeError describes a data item that can not be decoded into a Go
+// value of a given type.
+type UnmarshalTypeError struct {
+	CBORType string
+	GoType   reflect.Type
+	Offset   int64
+	Path     string
+}
+
+func (e *UnmarshalTypeError) Error() string {
+	return fmt.Sprintf("cbor: can not unmarshal %s into %s of type %s (offset %d)", e.CBORType, pathString(e.Path), e.GoType, e.Offset)
+}
+
+// UnknownFieldError describes a map key that matches no field of the struct
+// it is decoded into. Path ends with the key.
+type UnknownFieldError struct {
+	Field  string
+	GoType reflect.Type
+	Offset int64
+	Path   string
+}
+
+func (e *UnknownFieldError) Error() string {
+	return fmt.Sprintf("cbor: unknown field %s in type %s (offset %d)", pathString(e.Path), e.GoType, e.Offset)
+}
+
+// DuplicateKeyError describes a key found twice in a map. Path ends with the
+// key.
+type DuplicateKeyError struct {
+	Key    string
+	Offset int64
+	Path   string
+}
+
+func (e *DuplicateKeyError) Error() string {
+	return fmt.Sprintf("cbor: duplicate key %s (offset %d)", pathString(e.Path), e.Offset)
+}
+
+// MaxLimitError describes an item exceeding a limit set on the Decoder.
+// Limit is either "depth" or "length".
+type MaxLimitError struct {
+	Limit  string
+	Max    int
+	Offset int64
+	Path   string
+}
+
+func (e *MaxLimitError) Error() string {
+	return fmt.Sprintf("cbor: max %s %d exceeded at %s (offset %d)", e.Limit, e.Max, pathString(e.Path), e.Offset)
+}
+
+// InvalidUTF8Error describes a text string that is not valid UTF-8. It
+// wraps ErrInvalidUTF8.
+type InvalidUTF8Error struct {
+	Offset int64
+	Path   string
+}
+
+func (e *InvalidUTF8Error) Error() string {
+	return fmt.Sprintf("cbor: invalid UTF-8 in text string at %s (offset %d)", pathString(e.Path), e.Offset)
+}
+
+func (e *InvalidUTF8Error) Unwrap() error {
+	return ErrInvalidUTF8
+}
+
+func pathString(p string) string {
+	if p == "" {
+		return "."
+	}
+	return p
+}
+
+// atPath prefixes the path of the errors that have one with the segment seg
+// while they are returned from nested values.
+func atPath(err error, seg string) error {
+	switch e := err.(type) {
+	case *UnmarshalTypeError:
+		e.Path = seg + e.Path
+	case *UnknownFieldError:
+		e.Path = seg + e.Path
+	case *DuplicateKeyError:
+		e.Path = seg + e.Path
+	case *MaxLimitError:
+		e.Path = seg + e.Path
+	case *InvalidUTF8Error:
+		e.Path = seg + e.Path
+	}
+	return err
+}
+
+// RawMessage is a raw encoded CBOR item. It can be used to delay the decoding
+// of an item or to copy an already encoded item as is.
+type RawMessage []byte
+
+var rawType = reflect.TypeOf(RawMessage(nil))
+
+type field struct {
+	name  string
+	index int
+	// key is the encoding of name as a text string
+	key []byte
+}
+
+// typeFields returns the exported fields of t that are not ignored with the
+// "-" tag and the index of the field marked with the "extra" option (-1 if t
+// has no such field). Only one field of type map can have this option.
+func typeFields(t reflect.Type) ([]field, int, error) {
+	var (
+		fs    []field
+		extra = -1
+	)
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if len(f.PkgPath) > 0 {
+			continue
+		}
+		n, opts := parseTag(f.Tag.Get("cbor"))
+		if n == "-" {
+			continue
+		}
+		if opts == "extra" {
+			if f.Type.Kind() != reflect.Map {
+				return nil, -1, fmt.Errorf("cbor: extra field %s of %s is not a map", f.Name, t)
+			}
+			if extra >= 0 {
+				return nil, -1, fmt.Errorf("cbor: %s has more than one extra field", t)
+			}
+			extra = i
+			continue
+		}
+		if n == "" {
+			n = f.Name
+		}
+		key := appendHeader(nil, String, infoOf(uint64(len(n))), uint64(len(n)))
+		fs = append(fs, field{name: n, index: i, key: append(key, n...)})
+	}
+	return fs, extra, nil
+}
+
+func parseTag(tag string) (string, string) {
+	if i := strings.Index(tag, ","); i >= 0 {
+		return tag[:i], tag[i+1:]
+	}
+	return tag, ""
+}
+
 const (
 	Uint byte = iota << 5
 	Int
@@ -47,11 +229,18 @@ const (
 )
 
 const (
-	TagRFC3339 = 0x00
-	TagUnix    = 0x01
-	TagItem    = 0x18
-	TagURI     = 0x20
-	TagRegex   = 0x23
+	TagRFC3339   = 0x00
+	TagUnix      = 0x01
+	TagBigPos    = 0x02
+	TagBigNeg    = 0x03
+	TagDecimal   = 0x04
+	TagBigFloat  = 0x05
+	TagItem      = 0x18
+	TagURI       = 0x20
+	TagBase64URL = 0x21
+	TagBase64    = 0x22
+	TagRegex     = 0x23
+	TagMIME      = 0x24
 )
 
 const (
@@ -61,222 +250,138 @@ const (
 	Len8
 )
 
-func Debug(w io.Writer, bs []byte) error {
-	return DebugReader(w, bytes.NewReader(bs))
-}
-
-func DebugReader(w io.Writer, r io.Reader) error {
-	return debugReader(w, bufio.NewReader(r), true)
-}
-
-func debugReader(w io.Writer, r *bufio.Reader, nl bool) error {
-	b, err := r.ReadByte()
-	if err != nil {
-		return err
-	}
+const (
+	Indefinite byte = 0x1F
+	Break           = Other | Indefinite
+)
 
-	switch m, a := b&0xE0, b&0x1F; m {
-	case Uint:
-		err = debugUint(w, r, a)
-	case Int:
-		err = debugInt(w, r, a)
-	case Bin:
-	case String:
-		err = debugString(w, r, a)
-	case Array:
-		err = debugArray(w, r, a)
-	case Map:
-		err = debugMap(w, r, a)
-	case Tag:
-	case Other:
-		err = debugOther(w, r, a)
+// floatSize returns the additional information of the shortest float
+// encoding that can hold f without loss of precision.
+func floatSize(f float64) byte {
+	switch {
+	case math.IsNaN(f) || math.IsInf(f, 0):
+		return Float16
+	case float64(float32(f)) != f:
+		return Float64
 	}
-	if nl {
-		fmt.Fprintln(w)
+	if g := float16frombits(float16bits(float32(f))); g == f {
+		return Float16
 	}
-	return err
+	return Float32
 }
 
-func debugArray(w io.Writer, r io.Reader, a byte) error {
-	size, err := sizeof(r, a)
-	if err != nil {
-		return err
-	}
-	var buf bytes.Buffer
-	buf.WriteString("[")
-
-	rs := bufio.NewReader(r)
-	for i := 0; i < size; i++ {
-		if err := debugReader(&buf, rs, false); err != nil {
-			return err
-		}
-		if i < size-1 {
-			buf.WriteString(", ")
+func float16frombits(b uint16) float64 {
+	var (
+		exp  = int(b>>10) & 0x1F
+		frac = float64(b & 0x3FF)
+		f    float64
+	)
+	switch exp {
+	case 0:
+		f = math.Ldexp(frac, -24)
+	case 0x1F:
+		if frac == 0 {
+			f = math.Inf(1)
+		} else {
+			f = math.NaN()
 		}
+	default:
+		f = math.Ldexp(frac+1024, exp-25)
 	}
-	buf.WriteString("]")
-	io.Copy(w, &buf)
-	return nil
-}
-
-func debugMap(w io.Writer, r io.Reader, a byte) error {
-	size, err := sizeof(r, a)
-	if err != nil {
-		return err
+	if b&0x8000 != 0 {
+		f = -f
 	}
-	var buf bytes.Buffer
-	buf.WriteString("{")
+	return f
+}
 
-	rs := bufio.NewReader(r)
-	for i := 0; i < size; i++ {
-		if err := debugReader(&buf, rs, false); err != nil {
-			return err
-		}
-		buf.WriteString(": ")
-		if err := debugReader(&buf, rs, false); err != nil {
-			return err
-		}
-		if i < size-1 {
-			buf.WriteString(", ")
+// float16bits converts f to a half precision float, truncating the bits of
+// the mantissa that do not fit.
+func float16bits(f float32) uint16 {
+	var (
+		bits = math.Float32bits(f)
+		sign = uint16(bits>>16) & 0x8000
+		exp  = int(bits>>23&0xFF) - 127 + 15
+		frac = bits & 0x7FFFFF
+	)
+	switch {
+	case bits&0x7FFFFFFF == 0:
+		return sign
+	case bits&0x7FFFFFFF > 0x7F800000:
+		return sign | 0x7E00
+	case exp >= 0x1F:
+		return sign | 0x7C00
+	case exp <= 0:
+		if exp < -10 {
+			return sign
 		}
+		frac |= 0x800000
+		return sign | uint16(frac>>uint(14-exp))
+	default:
+		return sign | uint16(exp)<<10 | uint16(frac>>13)
 	}
-	buf.WriteString("}")
-	io.Copy(w, &buf)
-	return nil
 }
 
-func debugOther(w io.Writer, r io.Reader, a byte) error {
-	if a < False {
-		fmt.Fprintf(w, fmt.Sprintf("simple(%d)", a))
-		return nil
-	}
+// appendFloat appends f encoded as a float of the width given by the
+// additional information a. NaN is always encoded as a quiet NaN without
+// payload.
+func appendFloat(bs []byte, f float64, a byte) []byte {
+	var v uint64
 	switch a {
-	case Simple:
-		var v uint8
-		binary.Read(r, binary.BigEndian, &v)
-		fmt.Fprintf(w, fmt.Sprintf("simple(%d)", v))
-	case False:
-		fmt.Fprint(w, "false")
-	case True:
-		fmt.Fprint(w, "true")
-	case Nil:
-		fmt.Fprint(w, "null")
-	case Undefined:
-		fmt.Fprint(w, "undefined")
 	case Float16:
+		v = uint64(float16bits(float32(f)))
 	case Float32:
-		var v uint32
-		binary.Read(r, binary.BigEndian, &v)
-		fmt.Fprintf(w, "%g", math.Float32frombits(v))
-	case Float64:
-		var v uint64
-		binary.Read(r, binary.BigEndian, &v)
-		fmt.Fprintf(w, "%g", math.Float64frombits(v))
-	}
-	return nil
-}
-
-func debugString(w io.Writer, r io.Reader, a byte) error {
-	size, err := sizeof(r, a)
-	if err != nil {
-		return err
-	}
-	bs := make([]byte, size)
-	if _, err := io.ReadFull(r, bs); err != nil {
-		return err
+		v = uint64(math.Float32bits(float32(f)))
+		if math.IsNaN(f) {
+			v = 0x7FC00000
+		}
+	default:
+		v = math.Float64bits(f)
+		if math.IsNaN(f) {
+			v = 0x7FF8000000000000
+		}
 	}
-	fmt.Fprintf(w, "%q", string(bs))
-	return nil
+	return appendHeader(bs, Other, a, v)
 }
 
-func debugUint(w io.Writer, r io.Reader, a byte) error {
-	var (
-		err  error
-		item uint
-	)
+// appendHeader appends the initial byte made of the major type m and the
+// additional information a followed by the argument v on the width given by
+// a.
+func appendHeader(bs []byte, m, a byte, v uint64) []byte {
+	bs = append(bs, m|a)
 	switch a {
 	case Len1:
-		var v uint8
-		err = binary.Read(r, binary.BigEndian, &v)
-		item = uint(v)
+		bs = append(bs, byte(v))
 	case Len2:
-		var v uint16
-		err = binary.Read(r, binary.BigEndian, &v)
-		item = uint(v)
+		bs = append(bs, byte(v>>8), byte(v))
 	case Len4:
-		var v uint32
-		err = binary.Read(r, binary.BigEndian, &v)
-		item = uint(v)
+		bs = append(bs, byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
 	case Len8:
-		var v uint64
-		err = binary.Read(r, binary.BigEndian, &v)
-		item = uint(v)
-	default:
-		item = uint(a)
-	}
-	if err != nil {
-		return err
+		bs = append(bs, byte(v>>56), byte(v>>48), byte(v>>40), byte(v>>32), byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
 	}
-	fmt.Fprintf(w, "%d", item)
-	return nil
+	return bs
 }
 
-func debugInt(w io.Writer, r io.Reader, a byte) error {
-	var (
-		err  error
-		item int
-	)
-	switch a {
-	case Len1:
-		var v int8
-		err = binary.Read(r, binary.BigEndian, &v)
-		item = int(v)
-	case Len2:
-		var v int16
-		err = binary.Read(r, binary.BigEndian, &v)
-		item = int(v)
-	case Len4:
-		var v int32
-		err = binary.Read(r, binary.BigEndian, &v)
-		item = int(v)
-	case Len8:
-		var v int64
-		err = binary.Read(r, binary.BigEndian, &v)
-		item = int(v)
+// infoOf returns the additional information of the shortest encoding of the
+// argument v.
+func infoOf(v uint64) byte {
+	switch {
+	case v < uint64(Len1):
+		return byte(v)
+	case v <= math.MaxUint8:
+		return Len1
+	case v <= math.MaxUint16:
+		return Len2
+	case v <= math.MaxUint32:
+		return Len4
 	default:
-		item = int(a)
+		return Len8
 	}
-	if err != nil {
-		return err
-	}
-	fmt.Fprintf(w, "%d", -1-item)
-	return nil
 }
 
-func sizeof(r io.Reader, a byte) (int, error) {
-	var (
-		size int
-		err  error
-	)
-	switch a {
-	case Len1:
-		var v uint8
-		err = binary.Read(r, binary.BigEndian, &v)
-		size = int(v)
-	case Len2:
-		var v uint16
-		err = binary.Read(r, binary.BigEndian, &v)
-		size = int(v)
-	case Len4:
-		var v uint32
-		err = binary.Read(r, binary.BigEndian, &v)
-		size = int(v)
-	case Len8:
-		var v uint64
-		err = binary.Read(r, binary.BigEndian, &v)
-		size = int(v)
-	default:
-		size = int(a)
+// fits reports whether v can be encoded with the additional information a.
+func fits(v uint64, a byte) bool {
+	if a < Len1 {
+		return v == uint64(a)
 	}
-	return size, err
+	return a <= Len8 && infoOf(v) <= a
 }
@@ -0,0 +1,96 @@
+package cbor
+
+import (
+	"reflect"
+	"sync"
+)
+
+// encoderFunc writes the encoding of v to the buffer of e.
+type encoderFunc func(e *Encoder, v reflect.Value) error
+
+// decoderFunc decodes the next data item read by d into v.
+type decoderFunc func(d *Decoder, v reflect.Value) error
+
+var (
+	encoderCache sync.Map // map[reflect.Type]encoderFunc
+	decoderCache sync.Map // map[reflect.Type]decoderFunc
+	structCache  sync.Map // map[reflect.Type]*structCodec
+)
+
+// typeEncoder returns the encoder of t, building it on first use. While it
+// is built, other lookups of t, from recursive types or other goroutines, get
+// a function waiting for it to be ready.
+func typeEncoder(t reflect.Type) encoderFunc {
+	if fn, ok := encoderCache.Load(t); ok {
+		return fn.(encoderFunc)
+	}
+	var (
+		wg sync.WaitGroup
+		fn encoderFunc
+	)
+	wg.Add(1)
+	fi, loaded := encoderCache.LoadOrStore(t, encoderFunc(func(e *Encoder, v reflect.Value) error {
+		wg.Wait()
+		return fn(e, v)
+	}))
+	if loaded {
+		return fi.(encoderFunc)
+	}
+	fn = newTypeEncoder(t)
+	wg.Done()
+	encoderCache.Store(t, fn)
+	return fn
+}
+
+// typeDecoder returns the decoder of t, building it on first use. See
+// typeEncoder.
+func typeDecoder(t reflect.Type) decoderFunc {
+	if fn, ok := decoderCache.Load(t); ok {
+		return fn.(decoderFunc)
+	}
+	var (
+		wg sync.WaitGroup
+		fn decoderFunc
+	)
+	wg.Add(1)
+	fi, loaded := decoderCache.LoadOrStore(t, decoderFunc(func(d *Decoder, v reflect.Value) error {
+		wg.Wait()
+		return fn(d, v)
+	}))
+	if loaded {
+		return fi.(decoderFunc)
+	}
+	fn = newTypeDecoder(t)
+	wg.Done()
+	decoderCache.Store(t, fn)
+	return fn
+}
+
+// structCodec describes how a struct type is mapped to a CBOR map.
+type structCodec struct {
+	fields []field
+	// byName gives the position in fields of the field of a given name
+	byName map[string]int
+	// extra is the index of the field marked with the "extra" option or -1
+	extra int
+	// err reports an invalid use of the options of the fields
+	err error
+}
+
+func cachedStruct(t reflect.Type) *structCodec {
+	if c, ok := structCache.Load(t); ok {
+		return c.(*structCodec)
+	}
+	fs, x, err := typeFields(t)
+	c := &structCodec{
+		fields: fs,
+		byName: make(map[string]int, len(fs)),
+		extra:  x,
+		err:    err,
+	}
+	for i, f := range fs {
+		c.byName[f.name] = i
+	}
+	ci, _ := structCache.LoadOrStore(t, c)
+	return ci.(*structCodec)
+}
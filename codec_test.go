@@ -0,0 +1,176 @@
+package cbor
+
+import (
+	"bytes"
+	"encoding/hex"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func TestCachedStruct(t *testing.T) {
+	type item struct {
+		Name  string `cbor:"name"`
+		Value int
+		skip  int
+		Other map[string]RawMessage `cbor:",extra"`
+	}
+	typ := reflect.TypeOf(item{})
+	c := cachedStruct(typ)
+	if c != cachedStruct(typ) {
+		t.Fatalf("struct codec not cached")
+	}
+	if c.extra != 3 {
+		t.Errorf("extra: want 3, got %d", c.extra)
+	}
+	keys := []string{"646e616d65", "6556616c7565"}
+	if len(c.fields) != len(keys) {
+		t.Fatalf("fields: want %d, got %d", len(keys), len(c.fields))
+	}
+	for i, k := range keys {
+		if got := hex.EncodeToString(c.fields[i].key); got != k {
+			t.Errorf("%s: want key 0x%s, got 0x%s", c.fields[i].name, k, got)
+		}
+		if j := c.byName[c.fields[i].name]; j != i {
+			t.Errorf("%s: want position %d, got %d", c.fields[i].name, i, j)
+		}
+	}
+}
+
+func TestInvalidExtraField(t *testing.T) {
+	type notMap struct {
+		A     int
+		Extra []RawMessage `cbor:",extra"`
+	}
+	type twice struct {
+		A      int
+		Extra  map[string]RawMessage `cbor:",extra"`
+		Extra2 map[string]RawMessage `cbor:",extra"`
+	}
+	for _, v := range []interface{}{new(notMap), new(twice)} {
+		if _, err := Marshal(v); err == nil {
+			t.Errorf("%T: marshal: expected error", v)
+		}
+		if err := Unmarshal([]byte{0xa1, 0x61, 0x41, 0x01}, v); err == nil {
+			t.Errorf("%T: unmarshal: expected error", v)
+		}
+	}
+}
+
+type node struct {
+	Value int
+	Next  *node
+	Kids  []node
+}
+
+func TestCodecRecursive(t *testing.T) {
+	in := node{
+		Value: 1,
+		Next:  &node{Value: 2},
+		Kids:  []node{{Value: 3, Kids: []node{}}},
+	}
+	bs, err := Marshal(in)
+	if err != nil {
+		t.Fatalf("marshal fail: %s", err)
+	}
+	var out node
+	if err := Unmarshal(bs, &out); err != nil {
+		t.Fatalf("unmarshal fail: %s", err)
+	}
+	if out.Next == nil || out.Next.Value != 2 || len(out.Kids) != 1 || out.Kids[0].Value != 3 {
+		t.Errorf("unexpected result: %+v", out)
+	}
+}
+
+func TestCodecConcurrent(t *testing.T) {
+	type pair struct {
+		Key   string
+		Items []uint
+	}
+	var (
+		in = pair{Key: "key", Items: []uint{1, 2, 3}}
+		wg sync.WaitGroup
+	)
+	want, err := Marshal(in)
+	if err != nil {
+		t.Fatalf("marshal fail: %s", err)
+	}
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			bs, err := Marshal(in)
+			if err != nil || !bytes.Equal(bs, want) {
+				t.Errorf("marshal: want %x, got %x (%v)", want, bs, err)
+				return
+			}
+			var out pair
+			if err := Unmarshal(bs, &out); err != nil || !reflect.DeepEqual(in, out) {
+				t.Errorf("unmarshal: want %+v, got %+v (%v)", in, out, err)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestUnmarshalDuplicateField(t *testing.T) {
+	type item struct {
+		Name string
+	}
+	data := []string{
+		"a2644e616d65616164 4e616d656162",
+		"a2644e616d656161 664f74686572730a",
+	}
+	for i, str := range data {
+		bs, _ := hex.DecodeString(stripSpaces(str))
+		var v item
+		if err := Unmarshal(bs, &v); err == nil {
+			t.Errorf("%d: expected error, got %+v", i, v)
+		}
+	}
+}
+
+type benchItem struct {
+	Id    int               `cbor:"id"`
+	Name  string            `cbor:"name"`
+	Score float64           `cbor:"score"`
+	Tags  []string          `cbor:"tags"`
+	Attrs map[string]uint64 `cbor:"attrs"`
+	Next  *benchItem        `cbor:"next"`
+}
+
+var benchValue = benchItem{
+	Id:    1,
+	Name:  "first",
+	Score: 1.5,
+	Tags:  []string{"a", "b", "c"},
+	Attrs: map[string]uint64{"x": 1, "y": 2},
+	Next:  &benchItem{Id: 2, Name: "second"},
+}
+
+func BenchmarkMarshalStruct(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		bs, err := Marshal(&benchValue)
+		if err != nil {
+			b.Fatal(err)
+		}
+		b.SetBytes(int64(len(bs)))
+	}
+}
+
+func BenchmarkUnmarshalStruct(b *testing.B) {
+	bs, err := Marshal(&benchValue)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	b.SetBytes(int64(len(bs)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var v benchItem
+		if err := Unmarshal(bs, &v); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package cbor
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// Equal reports whether a and b hold data items that are equal in the CBOR
+// data model. The width of the arguments, the width of floats holding the
+// same value, indefinite lengths, chunks of strings and the order of map
+// entries are not taken into account.
+func Equal(a, b []byte) (bool, error) {
+	c, err := Compare(a, b)
+	return err == nil && c == 0, err
+}
+
+// Compare compares the data items held by a and b using the order of the
+// deterministic encoding (RFC 8949 section 4.2.1): the bytewise lexicographic
+// order of their deterministic encodings. The result is 0 if a and b are
+// equal, -1 if a sorts before b and +1 otherwise.
+func Compare(a, b []byte) (int, error) {
+	x, err := deterministic(a)
+	if err != nil {
+		return 0, err
+	}
+	y, err := deterministic(b)
+	if err != nil {
+		return 0, err
+	}
+	return bytes.Compare(x, y), nil
+}
+
+// deterministic returns the deterministic encoding of the single data item
+// held by bs.
+func deterministic(bs []byte) ([]byte, error) {
+	v, err := decodeOne(bs)
+	if err != nil {
+		return nil, err
+	}
+	return v.encode(nil, encodeDeterministic), nil
+}
+
+// decodeOne decodes the single data item held by bs into a Value.
+func decodeOne(bs []byte) (Value, error) {
+	var (
+		r = bytes.NewReader(bs)
+		v Value
+	)
+	if err := NewDecoder(r).Decode(&v); err != nil {
+		return v, err
+	}
+	if r.Len() > 0 {
+		return v, fmt.Errorf("cbor: %d trailing bytes after item", r.Len())
+	}
+	return v, nil
+}
@@ -0,0 +1,104 @@
+package cbor
+
+import (
+	"encoding/hex"
+	"testing"
+)
+
+func TestEqual(t *testing.T) {
+	data := []struct {
+		A, B  string
+		Equal bool
+		Err   bool
+	}{
+		{A: "18", B: "18", Err: true},
+		{A: "0102", B: "01", Err: true},
+		{A: "1818", B: "18", Err: true},
+		{A: "01", B: "1801", Equal: true},
+		{A: "1818", B: "1b0000000000000018", Equal: true},
+		{A: "20", B: "3a00000000", Equal: true},
+		{A: "01", B: "20"},
+		{A: "01", B: "f93c00"},
+		{A: "f93c00", B: "fa3f800000", Equal: true},
+		{A: "f93c00", B: "fb3ff0000000000000", Equal: true},
+		{A: "f97e00", B: "fb7ff8000000000000", Equal: true},
+		{A: "f90000", B: "f98000"},
+		{A: "fa3f8ccccd", B: "fb3ff199999999999a"},
+		{A: "6449455446", B: "7f624945625446ff", Equal: true},
+		{A: "4401020304", B: "5f42010243030405ff"},
+		{A: "4401020304", B: "5f4201025802 0304ff", Equal: true},
+		{A: "6161", B: "4161"},
+		{A: "83010203", B: "9f010203ff", Equal: true},
+		{A: "83010203", B: "83010302"},
+		{A: "a26161016162820203", B: "a2616282020361610 1", Equal: true},
+		{A: "a26161016162820203", B: "bf6162820203616101ff", Equal: true},
+		{A: "a1616101", B: "a1616102"},
+		{A: "a1a2010203f6f5", B: "a1a2030401f6f5"},
+		{A: "a1a2010203f6f5", B: "a1a203f60102f5", Equal: true},
+		{A: "c11a514b67b0", B: "d8011a514b67b0", Equal: true},
+		{A: "c11a514b67b0", B: "c01a514b67b0"},
+		{A: "f4", B: "f5"},
+		{A: "f6", B: "f7"},
+	}
+	for i, d := range data {
+		a, _ := hex.DecodeString(d.A)
+		b, err := hex.DecodeString(stripSpaces(d.B))
+		if err != nil {
+			t.Fatalf("%d: fail to decode hex string: %s", i+1, err)
+		}
+		eq, err := Equal(a, b)
+		if d.Err {
+			if err == nil || eq {
+				t.Errorf("%d: expected error and not equal, got %t, %v", i+1, eq, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%d: unexpected error: %s", i+1, err)
+			continue
+		}
+		if eq != d.Equal {
+			t.Errorf("%d: %s == %s: want %t, got %t", i+1, d.A, d.B, d.Equal, eq)
+		}
+	}
+}
+
+func TestCompare(t *testing.T) {
+	// items sorted in the order given by RFC 8949 section 4.2.1
+	data := []string{
+		"0a",
+		"1864",
+		"39ffff",
+		"6161",
+		"627a7a",
+		"812d",
+		"a0",
+		"f4",
+		"f93c00",
+	}
+	for i := 1; i < len(data); i++ {
+		a, _ := hex.DecodeString(data[i-1])
+		b, _ := hex.DecodeString(data[i])
+		c, err := Compare(a, b)
+		if err != nil {
+			t.Errorf("%d: unexpected error: %s", i, err)
+			continue
+		}
+		if c >= 0 {
+			t.Errorf("%s should sort before %s", data[i-1], data[i])
+		}
+		if c, _ := Compare(b, a); c <= 0 {
+			t.Errorf("%s should sort after %s", data[i], data[i-1])
+		}
+	}
+}
+
+func stripSpaces(s string) string {
+	var bs []byte
+	for i := 0; i < len(s); i++ {
+		if s[i] != ' ' {
+			bs = append(bs, s[i])
+		}
+	}
+	return string(bs)
+}
@@ -0,0 +1,397 @@
+package cbor
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// DebugOptions configures the output of the diagnostic notation.
+type DebugOptions struct {
+	// Indent is written once per level of nesting before each entry of
+	// arrays and maps, which are then written on several lines. Items are
+	// written on a single line when Indent is empty.
+	Indent string
+	// MaxDepth is the number of levels of nested arrays and maps that are
+	// written. Deeper containers are written as [...] or {...}. Zero means
+	// no limit.
+	MaxDepth int
+	// MaxLength is the maximum number of bytes written for a string. Longer
+	// strings are cut and followed by "...". Zero means no limit.
+	MaxLength int
+	// Color highlights the items with ANSI escape codes based on their major
+	// type.
+	Color bool
+}
+
+func Debug(w io.Writer, bs []byte) error {
+	return DebugOptions{}.Debug(w, bs)
+}
+
+// DebugReader writes the diagnostic notation (RFC 8949 section 8) of each
+// data item read from r to w, one item per line. The output is written while
+// the input is read, so the memory used does not depend on the size of the
+// items.
+func DebugReader(w io.Writer, r io.Reader) error {
+	return DebugOptions{}.DebugReader(w, r)
+}
+
+func (o DebugOptions) Debug(w io.Writer, bs []byte) error {
+	return o.DebugReader(w, bytes.NewReader(bs))
+}
+
+func (o DebugOptions) DebugReader(w io.Writer, r io.Reader) error {
+	p := printer{
+		w:    bufio.NewWriter(w),
+		s:    newScanner(r),
+		opts: o,
+	}
+	for p.s.more() {
+		if err := p.item(); err != nil {
+			p.w.Flush()
+			return err
+		}
+		p.w.WriteByte('\n')
+	}
+	return p.w.Flush()
+}
+
+type printer struct {
+	w     *bufio.Writer
+	s     *scanner
+	opts  DebugOptions
+	depth int
+}
+
+func (p *printer) item() error {
+	h, err := p.s.header()
+	if err != nil {
+		return err
+	}
+	if h.IsBreak() {
+		return p.s.errorf(h.offset, "unexpected break")
+	}
+	if h.Major != Array && h.Major != Map {
+		p.color(h.Major)
+		defer p.reset()
+	}
+	switch h.Major {
+	case Uint:
+		fmt.Fprintf(p.w, "%d%s", h.Arg, indicator(h.Info, h.Arg))
+	case Int:
+		if h.Arg == math.MaxUint64 {
+			p.w.WriteString("-18446744073709551616")
+		} else {
+			fmt.Fprintf(p.w, "-%d", h.Arg+1)
+		}
+		p.w.WriteString(indicator(h.Info, h.Arg))
+	case Bin, String:
+		err = p.str(h)
+	case Array, Map:
+		err = p.container(h)
+	case Tag:
+		fmt.Fprintf(p.w, "%d%s(", h.Arg, indicator(h.Info, h.Arg))
+		p.reset()
+		if err = p.item(); err == nil {
+			p.color(h.Major)
+			p.w.WriteByte(')')
+		}
+	case Other:
+		p.simple(h)
+	}
+	return err
+}
+
+func (p *printer) container(h header) error {
+	opener, closer := byte('['), byte(']')
+	if h.Major == Map {
+		opener, closer = '{', '}'
+	}
+	p.w.WriteByte(opener)
+	if p.opts.MaxDepth > 0 && p.depth >= p.opts.MaxDepth {
+		if err := p.skip(h); err != nil {
+			return err
+		}
+		p.w.WriteString("...")
+		p.w.WriteByte(closer)
+		return nil
+	}
+	prefix := indicator(h.Info, h.Arg)
+	if h.Indefinite() {
+		prefix = "_"
+	}
+	p.w.WriteString(prefix)
+	if prefix != "" && p.opts.Indent == "" {
+		p.w.WriteByte(' ')
+	}
+
+	p.depth++
+	var i uint64
+	for ; ; i++ {
+		if h.Indefinite() {
+			brk, err := p.s.peekBreak()
+			if err != nil {
+				return err
+			}
+			if brk {
+				break
+			}
+		} else if i >= h.Arg {
+			break
+		}
+		if i > 0 {
+			p.w.WriteByte(',')
+		}
+		if p.opts.Indent != "" {
+			p.newline()
+		} else if i > 0 {
+			p.w.WriteByte(' ')
+		}
+		if err := p.item(); err != nil {
+			return err
+		}
+		if h.Major != Map {
+			continue
+		}
+		p.w.WriteString(": ")
+		if err := p.item(); err != nil {
+			return err
+		}
+	}
+	p.depth--
+	if p.opts.Indent != "" {
+		if i > 0 {
+			p.newline()
+		} else if prefix != "" {
+			p.w.WriteByte(' ')
+		}
+	}
+	p.w.WriteByte(closer)
+	return nil
+}
+
+// skip discards the entries of a container.
+func (p *printer) skip(h header) error {
+	off := p.s.off
+	if h.Indefinite() {
+		return p.s.truncated(shiftError(skipIndefinite(p.s, h.Major), off))
+	}
+	n := h.Arg
+	if h.Major == Map {
+		n *= 2
+	}
+	_, err := skip(p.s, n, nil)
+	return p.s.truncated(shiftError(err, off))
+}
+
+func (p *printer) str(h header) error {
+	if !h.Indefinite() {
+		return p.chunk(h)
+	}
+	var i int
+	for ; ; i++ {
+		c, ok, err := p.s.chunk(h.Major)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			break
+		}
+		if i == 0 {
+			p.w.WriteString("(_ ")
+		} else {
+			p.w.WriteString(", ")
+		}
+		if err := p.chunk(c); err != nil {
+			return err
+		}
+	}
+	switch {
+	case i > 0:
+		p.w.WriteByte(')')
+	case h.Major == Bin:
+		p.w.WriteString("''_")
+	default:
+		p.w.WriteString("\"\"_")
+	}
+	return nil
+}
+
+// chunk writes the payload of a definite length string. Text strings are
+// read by blocks that are cut on UTF-8 sequence boundaries. Only the first
+// MaxLength bytes are written, the others are discarded.
+func (p *printer) chunk(h header) error {
+	if h.Arg > math.MaxInt64 {
+		return p.s.errorf(h.offset, "string too long")
+	}
+	n, rest := h.Arg, uint64(0)
+	if z := uint64(p.opts.MaxLength); z > 0 && n > z {
+		n, rest = z, n-z
+	}
+	if h.Major == Bin {
+		p.w.WriteString("h'")
+		if _, err := io.CopyN(hex.NewEncoder(p.w), p.s, int64(n)); err != nil {
+			return p.s.truncated(err)
+		}
+		p.w.WriteByte('\'')
+	} else {
+		var (
+			buf  [512]byte
+			keep int
+		)
+		p.w.WriteByte('"')
+		for n > 0 {
+			z := len(buf) - keep
+			if uint64(z) > n {
+				z = int(n)
+			}
+			if err := p.s.readFull(buf[keep : keep+z]); err != nil {
+				return err
+			}
+			n -= uint64(z)
+
+			data, end := buf[:keep+z], keep+z
+			if n > 0 || rest > 0 {
+				end = fullRunes(data)
+			}
+			writeQuoted(p.w, data[:end])
+			keep = copy(buf[:], data[end:])
+		}
+		p.w.WriteByte('"')
+	}
+	if rest > 0 {
+		if _, err := io.CopyN(io.Discard, p.s, int64(rest)); err != nil {
+			return p.s.truncated(err)
+		}
+		p.w.WriteString("...")
+	}
+	p.w.WriteString(indicator(h.Info, h.Arg))
+	return nil
+}
+
+func (p *printer) simple(h header) {
+	switch h.Info {
+	case False:
+		p.w.WriteString("false")
+	case True:
+		p.w.WriteString("true")
+	case Nil:
+		p.w.WriteString("null")
+	case Undefined:
+		p.w.WriteString("undefined")
+	case Float16:
+		p.float(float16frombits(uint16(h.Arg)), h.Info)
+	case Float32:
+		p.float(float64(math.Float32frombits(uint32(h.Arg))), h.Info)
+	case Float64:
+		p.float(math.Float64frombits(h.Arg), h.Info)
+	default:
+		fmt.Fprintf(p.w, "simple(%d)", h.Arg)
+	}
+}
+
+func (p *printer) float(f float64, a byte) {
+	p.w.WriteString(formatFloat(f))
+	if z := floatSize(f); z != a {
+		fmt.Fprintf(p.w, "_%d", a-Len1)
+	}
+}
+
+func (p *printer) newline() {
+	p.w.WriteByte('\n')
+	for i := 0; i < p.depth; i++ {
+		p.w.WriteString(p.opts.Indent)
+	}
+}
+
+var colors = map[byte]string{
+	Uint:   "\x1b[36m",
+	Int:    "\x1b[36m",
+	Bin:    "\x1b[35m",
+	String: "\x1b[32m",
+	Tag:    "\x1b[33m",
+	Other:  "\x1b[34m",
+}
+
+func (p *printer) color(m byte) {
+	if p.opts.Color {
+		p.w.WriteString(colors[m])
+	}
+}
+
+func (p *printer) reset() {
+	if p.opts.Color {
+		p.w.WriteString("\x1b[0m")
+	}
+}
+
+// writeQuoted writes bs to w using the escape sequences of JSON.
+func writeQuoted(w *bufio.Writer, bs []byte) {
+	for len(bs) > 0 {
+		r, z := utf8.DecodeRune(bs)
+		bs = bs[z:]
+		switch r {
+		case '"', '\\':
+			w.WriteByte('\\')
+			w.WriteRune(r)
+		case '\b':
+			w.WriteString("\\b")
+		case '\f':
+			w.WriteString("\\f")
+		case '\n':
+			w.WriteString("\\n")
+		case '\r':
+			w.WriteString("\\r")
+		case '\t':
+			w.WriteString("\\t")
+		default:
+			if unicode.IsPrint(r) {
+				w.WriteRune(r)
+				break
+			}
+			if r > 0xFFFF {
+				r1, r2 := utf16.EncodeRune(r)
+				fmt.Fprintf(w, "\\u%04x\\u%04x", r1, r2)
+			} else {
+				fmt.Fprintf(w, "\\u%04x", r)
+			}
+		}
+	}
+}
+
+// indicator returns the encoding indicator of an argument v encoded with the
+// additional information a or an empty string if v was encoded in its
+// shortest form.
+func indicator(a byte, v uint64) string {
+	if a < Len1 || a > Len8 {
+		return ""
+	}
+	if infoOf(v) == a {
+		return ""
+	}
+	return fmt.Sprintf("_%d", a-Len1)
+}
+
+func formatFloat(f float64) string {
+	switch {
+	case math.IsNaN(f):
+		return "NaN"
+	case math.IsInf(f, 1):
+		return "Infinity"
+	case math.IsInf(f, -1):
+		return "-Infinity"
+	}
+	s := strconv.FormatFloat(f, 'g', -1, 64)
+	if !strings.ContainsAny(s, ".en") {
+		s += ".0"
+	}
+	return s
+}
@@ -3,8 +3,11 @@ package cbor
 import (
 	"bytes"
 	"encoding/hex"
+	"fmt"
+	"io"
 	"strings"
 	"testing"
+	"testing/iotest"
 )
 
 type debugunit struct {
@@ -16,6 +19,8 @@ func TestDebugArray(t *testing.T) {
 	data := []debugunit{
 		{Raw: "80", Want: "[]\n"},
 		{Raw: "83010203", Want: "[1, 2, 3]\n"},
+		{Raw: "9f018202039f0405ffff", Want: "[_ 1, [2, 3], [_ 4, 5]]\n"},
+		{Raw: "9803010203", Want: "[_0 1, 2, 3]\n"},
 	}
 	testDebug(t, data)
 }
@@ -25,6 +30,7 @@ func TestDebugMap(t *testing.T) {
 		{Raw: "a0", Want: "{}\n"},
 		{Raw: "a201020304", Want: "{1: 2, 3: 4}\n"},
 		{Raw: "a26161016162820203", Want: "{\"a\": 1, \"b\": [2, 3]}\n"},
+		{Raw: "bf61610161629f0203ffff", Want: "{_ \"a\": 1, \"b\": [_ 2, 3]}\n"},
 	}
 	testDebug(t, data)
 }
@@ -36,6 +42,10 @@ func TestDebugUnsigned(t *testing.T) {
 		{Raw: "17", Want: "23\n"},
 		{Raw: "1818", Want: "24\n"},
 		{Raw: "1819", Want: "25\n"},
+		{Raw: "1b000000e8d4a51000", Want: "1000000000000\n"},
+		{Raw: "1bffffffffffffffff", Want: "18446744073709551615\n"},
+		{Raw: "1800", Want: "0_0\n"},
+		{Raw: "190018", Want: "24_1\n"},
 	}
 	testDebug(t, data)
 }
@@ -46,6 +56,9 @@ func TestDebugSigned(t *testing.T) {
 		{Raw: "29", Want: "-10\n"},
 		{Raw: "3863", Want: "-100\n"},
 		{Raw: "3903e7", Want: "-1000\n"},
+		{Raw: "38ff", Want: "-256\n"},
+		{Raw: "3bffffffffffffffff", Want: "-18446744073709551616\n"},
+		{Raw: "3a00000001", Want: "-2_2\n"},
 	}
 	testDebug(t, data)
 }
@@ -55,6 +68,21 @@ func TestDebugFloat(t *testing.T) {
 		{Raw: "fa47c35000", Want: "100000.0\n"},
 		{Raw: "fa7f7fffff", Want: "3.4028234663852886e+38\n"},
 		{Raw: "f9c400", Want: "-4.0\n"},
+		{Raw: "f90000", Want: "0.0\n"},
+		{Raw: "f98000", Want: "-0.0\n"},
+		{Raw: "f93e00", Want: "1.5\n"},
+		{Raw: "f97bff", Want: "65504.0\n"},
+		{Raw: "f90001", Want: "5.960464477539063e-08\n"},
+		{Raw: "f90400", Want: "6.103515625e-05\n"},
+		{Raw: "fb3ff199999999999a", Want: "1.1\n"},
+		{Raw: "fb7e37e43c8800759c", Want: "1e+300\n"},
+		{Raw: "f97c00", Want: "Infinity\n"},
+		{Raw: "f97e00", Want: "NaN\n"},
+		{Raw: "f9fc00", Want: "-Infinity\n"},
+		{Raw: "fa7fc00000", Want: "NaN_2\n"},
+		{Raw: "fb7ff0000000000000", Want: "Infinity_3\n"},
+		{Raw: "fa3fc00000", Want: "1.5_2\n"},
+		{Raw: "fb3ff8000000000000", Want: "1.5_3\n"},
 	}
 	testDebug(t, data)
 }
@@ -81,11 +109,111 @@ func TestDebugString(t *testing.T) {
 		{Raw: "62c3bc", Want: "\"\u00fc\"\n"},
 		{Raw: "63e6b0b4", Want: "\"\u6c34\"\n"},
 		// {Raw: "64f0908591", Want: "\"\ud800\udd51\"\n"},
+		{Raw: "7f657374726561646d696e67ff", Want: "(_ \"strea\", \"ming\")\n"},
+		{Raw: "780161", Want: "\"a\"_0\n"},
+		{Raw: "7fff", Want: "\"\"_\n"},
+		{Raw: "6400090a7f", Want: "\"\\u0000\\t\\n\\u007f\"\n"},
 	}
 	testDebug(t, data)
 }
 
-func testDebug(t *testing.T, data []debugunit) {
+func TestDebugBytes(t *testing.T) {
+	data := []debugunit{
+		{Raw: "40", Want: "h''\n"},
+		{Raw: "4401020304", Want: "h'01020304'\n"},
+		{Raw: "5f42010243030405ff", Want: "(_ h'0102', h'030405')\n"},
+		{Raw: "5f ff", Want: "''_\n"},
+	}
+	testDebug(t, data)
+}
+
+func TestDebugTag(t *testing.T) {
+	data := []debugunit{
+		{Raw: "c074323031332d30332d32315432303a30343a30305a", Want: "0(\"2013-03-21T20:04:00Z\")\n"},
+		{Raw: "c11a514b67b0", Want: "1(1363896240)\n"},
+		{Raw: "d82076687474703a2f2f7777772e6578616d706c652e636f6d", Want: "32(\"http://www.example.com\")\n"},
+		{Raw: "d74401020304", Want: "23(h'01020304')\n"},
+		{Raw: "d818456449455446", Want: "24(h'6449455446')\n"},
+		{Raw: "d80101", Want: "1_0(1)\n"},
+	}
+	testDebug(t, data)
+}
+
+func TestDebugSequence(t *testing.T) {
+	data := []debugunit{
+		{Raw: "", Want: ""},
+		{Raw: "0102", Want: "1\n2\n"},
+		{Raw: "6161a0f6", Want: "\"a\"\n{}\nnull\n"},
+	}
+	testDebug(t, data)
+}
+
+func TestDebugStream(t *testing.T) {
+	var (
+		str  = strings.Repeat("a", 511) + "\u6c34" + strings.Repeat("b", 1000)
+		item = []interface{}{str, []interface{}{1, "x"}, 2}
+		want = fmt.Sprintf("[%q, [1, \"x\"], 2]\n", str)
+	)
+	bs, err := Marshal(item)
+	if err != nil {
+		t.Fatalf("fail to marshal: %s", err)
+	}
+	var w bytes.Buffer
+	if err := DebugReader(&w, iotest.OneByteReader(bytes.NewReader(append(bs, bs...)))); err != nil {
+		t.Fatalf("fail to debug: %s", err)
+	}
+	if got := w.String(); got != want+want {
+		t.Errorf("output mismatched")
+	}
+}
+
+func TestDebugOptions(t *testing.T) {
+	data := []struct {
+		Raw     string
+		Options DebugOptions
+		Want    string
+	}{
+		{
+			Raw:     "a26161016162820203",
+			Options: DebugOptions{Indent: "  "},
+			Want:    "{\n  \"a\": 1,\n  \"b\": [\n    2,\n    3\n  ]\n}\n",
+		},
+		{
+			Raw:     "9f80a09fffc1820102ff",
+			Options: DebugOptions{Indent: "\t"},
+			Want:    "[_\n\t[],\n\t{},\n\t[_ ],\n\t1([\n\t\t1,\n\t\t2\n\t])\n]\n",
+		},
+		{
+			Raw:     "82018202820304",
+			Options: DebugOptions{MaxDepth: 2},
+			Want:    "[1, [2, [...]]]\n",
+		},
+		{
+			Raw:     "a161618201bf6162f6ff",
+			Options: DebugOptions{MaxDepth: 1},
+			Want:    "{\"a\": [...]}\n",
+		},
+		{
+			Raw:     "8201bf6162f6ff",
+			Options: DebugOptions{MaxDepth: 1, Indent: " "},
+			Want:    "[\n 1,\n {...}\n]\n",
+		},
+		{
+			Raw:     "83664945544649464401020304656162e6b0b4",
+			Options: DebugOptions{MaxLength: 4},
+			Want:    "[\"IETF\"..., h'01020304', \"ab\"...]\n",
+		},
+		{
+			Raw:     "5f4401020304410fff",
+			Options: DebugOptions{MaxLength: 2},
+			Want:    "(_ h'0102'..., h'0f')\n",
+		},
+		{
+			Raw:     "a2616101c1f5f6",
+			Options: DebugOptions{Color: true},
+			Want:    "{\x1b[32m\"a\"\x1b[0m: \x1b[36m1\x1b[0m, \x1b[33m1(\x1b[0m\x1b[34mtrue\x1b[0m\x1b[33m)\x1b[0m: \x1b[34mnull\x1b[0m}\n",
+		},
+	}
 	for i, d := range data {
 		bs, err := hex.DecodeString(d.Raw)
 		if err != nil {
@@ -93,6 +221,34 @@ func testDebug(t *testing.T, data []debugunit) {
 			continue
 		}
 		var w bytes.Buffer
+		if err := d.Options.Debug(&w, bs); err != nil {
+			t.Errorf("%d: failed to debug %s => %s", i+1, d.Raw, err)
+			continue
+		}
+		if got := w.String(); got != d.Want {
+			t.Errorf("%d: want %q, got %q", i+1, d.Want, got)
+		}
+	}
+}
+
+func TestDebugInvalid(t *testing.T) {
+	data := []string{"18", "62", "ff", "8201", "5f6161ff", "f8", "fc"}
+	for i, d := range data {
+		bs, _ := hex.DecodeString(d)
+		if err := Debug(io.Discard, bs); err == nil {
+			t.Errorf("%d: expected error for %s", i+1, d)
+		}
+	}
+}
+
+func testDebug(t *testing.T, data []debugunit) {
+	for i, d := range data {
+		bs, err := hex.DecodeString(strings.ReplaceAll(d.Raw, " ", ""))
+		if err != nil {
+			t.Errorf("%d: fail to decode hex string: %s (%s)", i+1, err, d.Raw)
+			continue
+		}
+		var w bytes.Buffer
 		if err := Debug(&w, bs); err != nil {
 			t.Errorf("%d: failed to debug %s => %s", i+1, d.Raw, err)
 			continue
@@ -0,0 +1,176 @@
+package cbor
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// ChangeKind is the kind of difference reported by Diff.
+type ChangeKind int
+
+const (
+	// Added is an entry or element only found in the second document.
+	Added ChangeKind = iota
+	// Removed is an entry or element only found in the first document.
+	Removed
+	// Changed is an item whose value differs between the documents.
+	Changed
+	// TypeChanged is an item whose kind differs between the documents.
+	TypeChanged
+	// TagChanged is a tag whose number differs between the documents.
+	TagChanged
+)
+
+func (k ChangeKind) String() string {
+	switch k {
+	case Added:
+		return "added"
+	case Removed:
+		return "removed"
+	case Changed:
+		return "changed"
+	case TypeChanged:
+		return "type changed"
+	case TagChanged:
+		return "tag changed"
+	default:
+		return "unknown"
+	}
+}
+
+// Path locates an item in a document. Each segment is either the key of a map
+// entry or the index of an array element given as an unsigned integer.
+type Path []Value
+
+// String returns the segments of p in diagnostic notation, each between
+// brackets, after a leading dot. The root is written as a single dot.
+func (p Path) String() string {
+	var str strings.Builder
+	str.WriteByte('.')
+	for _, v := range p {
+		str.WriteByte('[')
+		str.WriteString(v.String())
+		str.WriteByte(']')
+	}
+	return str.String()
+}
+
+func (p Path) append(v Value) Path {
+	q := make(Path, len(p), len(p)+1)
+	copy(q, p)
+	return append(q, v)
+}
+
+// Change is a difference between two documents. Old is invalid for Added
+// changes and New is invalid for Removed changes.
+type Change struct {
+	Kind ChangeKind
+	Path Path
+	Old  Value
+	New  Value
+}
+
+// String returns a one line description of c using the diagnostic notation
+// for its values.
+func (c Change) String() string {
+	switch c.Kind {
+	case Added:
+		return fmt.Sprintf("+ %s: %s", c.Path, c.New)
+	case Removed:
+		return fmt.Sprintf("- %s: %s", c.Path, c.Old)
+	case TypeChanged:
+		return fmt.Sprintf("~ %s: %s -> %s (%s -> %s)", c.Path, c.Old, c.New, c.Old.Kind(), c.New.Kind())
+	case TagChanged:
+		return fmt.Sprintf("~ %s: %s -> %s (tag %d -> %d)", c.Path, c.Old, c.New, c.Old.num, c.New.num)
+	default:
+		return fmt.Sprintf("~ %s: %s -> %s", c.Path, c.Old, c.New)
+	}
+}
+
+// Diff returns the differences between the data items held by a and b. Items
+// are compared like Equal does. Maps are compared entry by entry and arrays
+// element by element, so that a change is reported at the deepest path where
+// the documents differ.
+func Diff(a, b []byte) ([]Change, error) {
+	x, err := decodeOne(a)
+	if err != nil {
+		return nil, err
+	}
+	y, err := decodeOne(b)
+	if err != nil {
+		return nil, err
+	}
+	return diffValues(nil, nil, x, y), nil
+}
+
+func diffValues(cs []Change, p Path, x, y Value) []Change {
+	if equalValues(x, y) {
+		return cs
+	}
+	if !sameKind(x.kind, y.kind) {
+		return append(cs, Change{Kind: TypeChanged, Path: p, Old: x, New: y})
+	}
+	switch x.kind {
+	case KindTag:
+		if x.num != y.num {
+			return append(cs, Change{Kind: TagChanged, Path: p, Old: x, New: y})
+		}
+		// paths have no segment for the content of tags: the whole tagged
+		// items are reported so that the tag is kept
+		return append(cs, Change{Kind: Changed, Path: p, Old: x, New: y})
+	case KindArray:
+		return diffArrays(cs, p, x.items, y.items)
+	case KindMap:
+		return diffMaps(cs, p, x.dict, y.dict)
+	default:
+		return append(cs, Change{Kind: Changed, Path: p, Old: x, New: y})
+	}
+}
+
+// diffArrays compares arrays element by element. Removed elements are
+// reported from the last one so that the changes can be applied in order.
+func diffArrays(cs []Change, p Path, xs, ys []Value) []Change {
+	var i int
+	for ; i < len(xs) && i < len(ys); i++ {
+		cs = diffValues(cs, p.append(NewUint(uint64(i))), xs[i], ys[i])
+	}
+	for j := i; j < len(ys); j++ {
+		cs = append(cs, Change{Kind: Added, Path: p.append(NewUint(uint64(j))), New: ys[j]})
+	}
+	for j := len(xs) - 1; j >= i; j-- {
+		cs = append(cs, Change{Kind: Removed, Path: p.append(NewUint(uint64(j))), Old: xs[j]})
+	}
+	return cs
+}
+
+func diffMaps(cs []Change, p Path, x, y *OrderedMap) []Change {
+	for i, k := range x.keys {
+		q := p.append(k)
+		if j, ok := y.index[keyOf(k)]; ok {
+			cs = diffValues(cs, q, x.values[i], y.values[j])
+		} else {
+			cs = append(cs, Change{Kind: Removed, Path: q, Old: x.values[i]})
+		}
+	}
+	for i, k := range y.keys {
+		if _, ok := x.index[keyOf(k)]; !ok {
+			cs = append(cs, Change{Kind: Added, Path: p.append(k), New: y.values[i]})
+		}
+	}
+	return cs
+}
+
+func equalValues(x, y Value) bool {
+	return bytes.Equal(x.encode(nil, encodeDeterministic), y.encode(nil, encodeDeterministic))
+}
+
+// sameKind reports whether a change between the kinds a and b is a change
+// of value rather than a change of type. Unsigned and negative integers
+// are both integers.
+func sameKind(a, b Kind) bool {
+	if a == b {
+		return true
+	}
+	return (a == KindUint || a == KindInt) && (b == KindUint || b == KindInt)
+}
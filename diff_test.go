@@ -0,0 +1,54 @@
+package cbor
+
+import (
+	"encoding/hex"
+	"testing"
+)
+
+func TestDiff(t *testing.T) {
+	data := []struct {
+		A, B string
+		Want []string
+	}{
+		{A: "01", B: "1801"},
+		{A: "a26161016162820203", B: "bf6162820203616101ff"},
+		{A: "01", B: "02", Want: []string{"~ .: 1 -> 2"}},
+		{A: "01", B: "20", Want: []string{"~ .: 1 -> -1"}},
+		{A: "01", B: "6131", Want: []string{`~ .: 1 -> "1" (uint -> text)`}},
+		{A: "83010203", B: "83010403", Want: []string{"~ .[1]: 2 -> 4"}},
+		{A: "83010203", B: "820102", Want: []string{"- .[2]: 3"}},
+		{A: "83010203", B: "8101", Want: []string{"- .[2]: 3", "- .[1]: 2"}},
+		{A: "820102", B: "83010203", Want: []string{"+ .[2]: 3"}},
+		{
+			A: "a261610161628102",
+			B: "a261628103616301",
+			Want: []string{
+				`- .["a"]: 1`,
+				`~ .["b"][0]: 2 -> 3`,
+				`+ .["c"]: 1`,
+			},
+		},
+		{A: "a10182f5f6", B: "a10182f4f6", Want: []string{"~ .[1][0]: true -> false"}},
+		{A: "c11a514b67b0", B: "c01a514b67b0", Want: []string{"~ .: 1(1363896240) -> 0(1363896240) (tag 1 -> 0)"}},
+		{A: "c11a514b67b0", B: "c11a514b67b1", Want: []string{"~ .: 1(1363896240) -> 1(1363896241)"}},
+		{A: "4101", B: "4102", Want: []string{"~ .: h'01' -> h'02'"}},
+	}
+	for i, d := range data {
+		a, _ := hex.DecodeString(d.A)
+		b, _ := hex.DecodeString(d.B)
+		cs, err := Diff(a, b)
+		if err != nil {
+			t.Errorf("%d: unexpected error: %s", i+1, err)
+			continue
+		}
+		if len(cs) != len(d.Want) {
+			t.Errorf("%d: number of changes mismatched: want %d, got %d (%v)", i+1, len(d.Want), len(cs), cs)
+			continue
+		}
+		for j, c := range cs {
+			if got := c.String(); got != d.Want[j] {
+				t.Errorf("%d: change %d mismatched: want %s, got %s", i+1, j+1, d.Want[j], got)
+			}
+		}
+	}
+}
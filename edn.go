@@ -0,0 +1,648 @@
+package cbor
+
+import (
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// ParseDiagnostic parses a sequence of data items written in the extended
+// diagnostic notation (RFC 8610 appendix G) and returns their encoding.
+//
+// Items of the sequence are separated by commas or white spaces. Comments are
+// either enclosed in slashes or start with a # and end with the line. The
+// output of Debug can always be parsed back to the bytes it was made of,
+// except for NaN payloads and text strings that are not valid UTF-8.
+func ParseDiagnostic(str string) ([]byte, error) {
+	p := ednParser{str: str}
+	return p.sequence(nil, "")
+}
+
+type ednParser struct {
+	str string
+	pos int
+}
+
+// sequence parses items until end is found or, when end is empty, until
+// the end of the input.
+func (p *ednParser) sequence(bs []byte, end string) ([]byte, error) {
+	for i := 0; ; i++ {
+		if err := p.skip(); err != nil {
+			return nil, err
+		}
+		if end == "" && p.done() || end != "" && p.accept(end) {
+			return bs, nil
+		}
+		if i > 0 && p.accept(",") {
+			if err := p.skip(); err != nil {
+				return nil, err
+			}
+		} else if i > 0 && end != "" {
+			return nil, p.errorf("expected ',' or %q", end)
+		}
+		var err error
+		if bs, err = p.item(bs); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (p *ednParser) item(bs []byte) ([]byte, error) {
+	if err := p.skip(); err != nil {
+		return nil, err
+	}
+	if p.done() {
+		return nil, p.errorf("unexpected end of input")
+	}
+	switch c := p.str[p.pos]; {
+	case c == '[' || c == '{':
+		return p.container(bs)
+	case c == '(':
+		return p.chunks(bs)
+	case c == '-' || isDigit(c):
+		return p.number(bs)
+	case p.isString():
+		return p.strings(bs)
+	case isLetter(c):
+		return p.keyword(bs)
+	default:
+		return nil, p.errorf("unexpected character %q", c)
+	}
+}
+
+func (p *ednParser) container(bs []byte) ([]byte, error) {
+	major, closer := byte(Array), "]"
+	if p.str[p.pos] == '{' {
+		major, closer = Map, "}"
+	}
+	p.pos++
+
+	a, ok := p.indicator()
+	indef := !ok && p.accept("_")
+
+	var (
+		body  []byte
+		count uint64
+		err   error
+	)
+	for {
+		if err := p.skip(); err != nil {
+			return nil, err
+		}
+		if p.accept(closer) {
+			break
+		}
+		if count > 0 {
+			if !p.accept(",") {
+				return nil, p.errorf("expected ',' or %q", closer)
+			}
+		}
+		if body, err = p.item(body); err != nil {
+			return nil, err
+		}
+		if major == Map {
+			if err := p.skip(); err != nil {
+				return nil, err
+			}
+			if !p.accept(":") {
+				return nil, p.errorf("expected ':'")
+			}
+			if body, err = p.item(body); err != nil {
+				return nil, err
+			}
+		}
+		count++
+	}
+	if indef {
+		bs = append(bs, major|Indefinite)
+		bs = append(bs, body...)
+		return append(bs, Break), nil
+	}
+	if !ok {
+		a = infoOf(count)
+	} else if !fits(count, a) {
+		return nil, p.errorf("length %d does not fit encoding indicator", count)
+	}
+	bs = appendHeader(bs, major, a, count)
+	return append(bs, body...), nil
+}
+
+// chunks parses an indefinite length string written as (_ chunk, ...).
+func (p *ednParser) chunks(bs []byte) ([]byte, error) {
+	p.pos++
+	if !p.accept("_") {
+		return nil, p.errorf("expected '_'")
+	}
+	var (
+		major byte
+		body  []byte
+	)
+	for i := 0; ; i++ {
+		if err := p.skip(); err != nil {
+			return nil, err
+		}
+		if p.accept(")") {
+			break
+		}
+		if i > 0 && !p.accept(",") {
+			return nil, p.errorf("expected ',' or ')'")
+		}
+		if err := p.skip(); err != nil {
+			return nil, err
+		}
+		if !p.isString() {
+			return nil, p.errorf("string expected in indefinite length string")
+		}
+		off := p.pos
+		s, err := p.string()
+		if err != nil {
+			return nil, err
+		}
+		if s.indefinite || i > 0 && s.major != major {
+			return nil, &SyntaxError{msg: "invalid chunk in indefinite length string", Offset: int64(off)}
+		}
+		major = s.major
+		body = s.append(body)
+	}
+	if major == 0 {
+		return nil, p.errorf("empty indefinite length string")
+	}
+	bs = append(bs, major|Indefinite)
+	bs = append(bs, body...)
+	return append(bs, Break), nil
+}
+
+type ednString struct {
+	major      byte
+	data       []byte
+	info       byte
+	indefinite bool
+}
+
+func (s ednString) append(bs []byte) []byte {
+	if s.indefinite {
+		return append(bs, s.major|Indefinite, Break)
+	}
+	bs = appendHeader(bs, s.major, s.info, uint64(len(s.data)))
+	return append(bs, s.data...)
+}
+
+func (p *ednParser) strings(bs []byte) ([]byte, error) {
+	s, err := p.string()
+	if err != nil {
+		return nil, err
+	}
+	return s.append(bs), nil
+}
+
+// string parses one or more concatenated string literals followed by an
+// optional encoding indicator. The type of the result is the type of the
+// first literal.
+func (p *ednParser) string() (ednString, error) {
+	var (
+		s     ednString
+		start = p.pos
+	)
+	for i := 0; ; i++ {
+		m, data, err := p.literal()
+		if err != nil {
+			return s, err
+		}
+		if i == 0 {
+			s.major = m
+		}
+		s.data = append(s.data, data...)
+
+		if p.peek() == '_' {
+			if a, ok := p.indicator(); ok {
+				s.info = a
+				break
+			}
+			if i > 0 || len(s.data) > 0 {
+				return s, p.errorf("unexpected '_'")
+			}
+			p.pos++
+			s.indefinite = true
+			return s, nil
+		}
+		pos := p.pos
+		if err := p.skip(); err != nil {
+			return s, err
+		}
+		if p.accept("+") {
+			if err := p.skip(); err != nil {
+				return s, err
+			}
+		} else if !p.isString() {
+			p.pos = pos
+			s.info = infoOf(uint64(len(s.data)))
+			break
+		}
+	}
+	if s.major == String && !utf8.Valid(s.data) {
+		return s, &SyntaxError{msg: "invalid UTF-8 in text string", Offset: int64(start)}
+	}
+	if !fits(uint64(len(s.data)), s.info) {
+		return s, p.errorf("length %d does not fit encoding indicator", len(s.data))
+	}
+	return s, nil
+}
+
+// literal parses a single string literal: "text", 'bytes', h'hex',
+// b32'base32', h32'base32hex', b64'base64' or <<embedded items>>.
+func (p *ednParser) literal() (byte, []byte, error) {
+	switch {
+	case p.accept("\""):
+		bs, err := p.quoted('"')
+		return String, bs, err
+	case p.accept("'"):
+		bs, err := p.quoted('\'')
+		return Bin, bs, err
+	case p.accept("h'"):
+		bs, err := p.encoded(func(s string) ([]byte, error) {
+			return hex.DecodeString(s)
+		})
+		return Bin, bs, err
+	case p.accept("b32'"):
+		bs, err := p.encoded(decodeBase32(base32.StdEncoding))
+		return Bin, bs, err
+	case p.accept("h32'"):
+		bs, err := p.encoded(decodeBase32(base32.HexEncoding))
+		return Bin, bs, err
+	case p.accept("b64'"):
+		bs, err := p.encoded(decodeBase64)
+		return Bin, bs, err
+	case p.accept("<<"):
+		bs, err := p.sequence(nil, ">>")
+		return Bin, bs, err
+	default:
+		return 0, nil, p.errorf("string expected")
+	}
+}
+
+// quoted parses the content of a quoted string up to the closing quote q.
+// The escape sequences are the ones of JSON and \'.
+func (p *ednParser) quoted(q byte) ([]byte, error) {
+	var bs []byte
+	for {
+		if p.done() {
+			return nil, p.errorf("unterminated string")
+		}
+		c := p.str[p.pos]
+		p.pos++
+		if c == q {
+			return bs, nil
+		}
+		if c != '\\' {
+			bs = append(bs, c)
+			continue
+		}
+		if p.done() {
+			return nil, p.errorf("unterminated string")
+		}
+		c = p.str[p.pos]
+		p.pos++
+		switch c {
+		case '"', '\'', '\\', '/':
+			bs = append(bs, c)
+		case 'b':
+			bs = append(bs, '\b')
+		case 'f':
+			bs = append(bs, '\f')
+		case 'n':
+			bs = append(bs, '\n')
+		case 'r':
+			bs = append(bs, '\r')
+		case 't':
+			bs = append(bs, '\t')
+		case 'u':
+			r, err := p.unicode()
+			if err != nil {
+				return nil, err
+			}
+			bs = utf8.AppendRune(bs, r)
+		default:
+			return nil, p.errorf("invalid escape sequence \\%c", c)
+		}
+	}
+}
+
+func (p *ednParser) unicode() (rune, error) {
+	hex4 := func() (rune, error) {
+		if p.pos+4 > len(p.str) {
+			return 0, p.errorf("invalid unicode escape")
+		}
+		v, err := strconv.ParseUint(p.str[p.pos:p.pos+4], 16, 16)
+		if err != nil {
+			return 0, p.errorf("invalid unicode escape")
+		}
+		p.pos += 4
+		return rune(v), nil
+	}
+	r, err := hex4()
+	if err != nil || !utf16.IsSurrogate(r) {
+		return r, err
+	}
+	if !p.accept("\\u") {
+		return 0, p.errorf("missing low surrogate")
+	}
+	r2, err := hex4()
+	if err != nil {
+		return 0, err
+	}
+	if r = utf16.DecodeRune(r, r2); r == utf8.RuneError {
+		return 0, p.errorf("invalid surrogate pair")
+	}
+	return r, nil
+}
+
+// encoded parses the content of a byte string written in a base encoding up
+// to the closing quote. White spaces and comments are ignored.
+func (p *ednParser) encoded(decode func(string) ([]byte, error)) ([]byte, error) {
+	var (
+		str strings.Builder
+		pos = p.pos
+	)
+	for {
+		if err := p.skip(); err != nil {
+			return nil, err
+		}
+		if p.done() {
+			return nil, p.errorf("unterminated string")
+		}
+		c := p.str[p.pos]
+		p.pos++
+		if c == '\'' {
+			break
+		}
+		str.WriteByte(c)
+	}
+	bs, err := decode(str.String())
+	if err != nil {
+		return nil, &SyntaxError{msg: fmt.Sprintf("invalid byte string: %s", err), Offset: int64(pos)}
+	}
+	return bs, nil
+}
+
+func decodeBase64(s string) ([]byte, error) {
+	enc := base64.StdEncoding
+	if strings.ContainsAny(s, "-_") {
+		enc = base64.URLEncoding
+	}
+	return enc.WithPadding(base64.NoPadding).DecodeString(strings.TrimRight(s, "="))
+}
+
+func decodeBase32(enc *base32.Encoding) func(string) ([]byte, error) {
+	return func(s string) ([]byte, error) {
+		return enc.WithPadding(base32.NoPadding).DecodeString(strings.TrimRight(s, "="))
+	}
+}
+
+// number parses an integer, a float or a tag. Integers that do not fit on 64
+// bits are encoded as bignums.
+func (p *ednParser) number(bs []byte) ([]byte, error) {
+	start := p.pos
+	neg := p.accept("-")
+	if p.acceptWord("Infinity") {
+		return p.float(bs, math.Inf(-1))
+	}
+	base, digits := 10, "0123456789"
+	switch {
+	case p.accept("0x") || p.accept("0X"):
+		base, digits = 16, "0123456789abcdefABCDEF"
+	case p.accept("0o"):
+		base, digits = 8, "01234567"
+	case p.accept("0b"):
+		base, digits = 2, "01"
+	}
+	pos := p.pos
+	p.span(digits)
+	if p.pos == pos {
+		return nil, p.errorf("digit expected")
+	}
+	if base == 10 && (p.peek() == '.' || p.peek() == 'e' || p.peek() == 'E') {
+		if p.accept(".") {
+			p.span(digits)
+		}
+		if p.accept("e") || p.accept("E") {
+			if !p.accept("+") {
+				p.accept("-")
+			}
+			p.span(digits)
+		}
+		f, err := strconv.ParseFloat(p.str[start:p.pos], 64)
+		if err != nil {
+			return nil, &SyntaxError{msg: fmt.Sprintf("invalid number %s", p.str[start:p.pos]), Offset: int64(start)}
+		}
+		return p.float(bs, f)
+	}
+
+	var v big.Int
+	v.SetString(p.str[pos:p.pos], base)
+	a, ok := p.indicator()
+	if p.peek() == '(' {
+		if neg || !v.IsUint64() {
+			return nil, &SyntaxError{msg: "invalid tag number", Offset: int64(start)}
+		}
+		return p.tagged(bs, v.Uint64(), a, ok)
+	}
+
+	major := Uint
+	if neg && v.Sign() > 0 {
+		major = Int
+		v.Sub(&v, big.NewInt(1))
+	}
+	if !v.IsUint64() {
+		if ok {
+			return nil, p.errorf("bignum can not have encoding indicator")
+		}
+		tag := uint64(TagBigPos)
+		if major == Int {
+			tag = TagBigNeg
+		}
+		bs = appendHeader(bs, Tag, infoOf(tag), tag)
+		return ednString{major: Bin, data: v.Bytes(), info: infoOf(uint64(len(v.Bytes())))}.append(bs), nil
+	}
+	if !ok {
+		a = infoOf(v.Uint64())
+	} else if !fits(v.Uint64(), a) {
+		return nil, p.errorf("value does not fit encoding indicator")
+	}
+	return appendHeader(bs, major, a, v.Uint64()), nil
+}
+
+func (p *ednParser) tagged(bs []byte, tag uint64, a byte, ok bool) ([]byte, error) {
+	p.pos++
+	if !ok {
+		a = infoOf(tag)
+	} else if !fits(tag, a) {
+		return nil, p.errorf("tag does not fit encoding indicator")
+	}
+	bs, err := p.item(appendHeader(bs, Tag, a, tag))
+	if err != nil {
+		return nil, err
+	}
+	if err := p.skip(); err != nil {
+		return nil, err
+	}
+	if !p.accept(")") {
+		return nil, p.errorf("expected ')'")
+	}
+	return bs, nil
+}
+
+func (p *ednParser) float(bs []byte, f float64) ([]byte, error) {
+	a, ok := p.indicator()
+	if !ok {
+		return appendFloat(bs, f, floatSize(f)), nil
+	}
+	if a < Float16 || floatSize(f) > a && !math.IsNaN(f) {
+		return nil, p.errorf("value does not fit encoding indicator")
+	}
+	return appendFloat(bs, f, a), nil
+}
+
+func (p *ednParser) keyword(bs []byte) ([]byte, error) {
+	start := p.pos
+	for !p.done() && isLetter(p.str[p.pos]) {
+		p.pos++
+	}
+	switch word := p.str[start:p.pos]; word {
+	case "false":
+		return append(bs, Other|False), nil
+	case "true":
+		return append(bs, Other|True), nil
+	case "null":
+		return append(bs, Other|Nil), nil
+	case "undefined":
+		return append(bs, Other|Undefined), nil
+	case "NaN":
+		return p.float(bs, math.NaN())
+	case "Infinity":
+		return p.float(bs, math.Inf(1))
+	case "simple":
+		return p.simple(bs)
+	default:
+		return nil, &SyntaxError{msg: fmt.Sprintf("unknown keyword %s", word), Offset: int64(start)}
+	}
+}
+
+func (p *ednParser) simple(bs []byte) ([]byte, error) {
+	if !p.accept("(") {
+		return nil, p.errorf("expected '('")
+	}
+	pos := p.pos
+	p.span("0123456789")
+	v, err := strconv.ParseUint(p.str[pos:p.pos], 10, 8)
+	if err != nil || v >= uint64(Len1) && v < 32 {
+		return nil, &SyntaxError{msg: "invalid simple value", Offset: int64(pos)}
+	}
+	if !p.accept(")") {
+		return nil, p.errorf("expected ')'")
+	}
+	return appendHeader(bs, Other, infoOf(v), v), nil
+}
+
+// indicator parses an encoding indicator _0 to _3 and returns the additional
+// information it stands for.
+func (p *ednParser) indicator() (byte, bool) {
+	if p.pos+1 >= len(p.str) || p.str[p.pos] != '_' {
+		return 0, false
+	}
+	c := p.str[p.pos+1]
+	if c < '0' || c > '3' {
+		return 0, false
+	}
+	p.pos += 2
+	return Len1 + c - '0', true
+}
+
+// skip skips white spaces and comments.
+func (p *ednParser) skip() error {
+	for !p.done() {
+		switch c := p.str[p.pos]; c {
+		case ' ', '\t', '\r', '\n':
+			p.pos++
+		case '/':
+			i := strings.IndexByte(p.str[p.pos+1:], '/')
+			if i < 0 {
+				return p.errorf("unterminated comment")
+			}
+			p.pos += i + 2
+		case '#':
+			i := strings.IndexByte(p.str[p.pos:], '\n')
+			if i < 0 {
+				p.pos = len(p.str)
+			} else {
+				p.pos += i + 1
+			}
+		default:
+			return nil
+		}
+	}
+	return nil
+}
+
+func (p *ednParser) isString() bool {
+	for _, s := range []string{"\"", "'", "h'", "b32'", "h32'", "b64'", "<<"} {
+		if strings.HasPrefix(p.str[p.pos:], s) {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *ednParser) span(chars string) {
+	for !p.done() && strings.IndexByte(chars, p.str[p.pos]) >= 0 {
+		p.pos++
+	}
+}
+
+func (p *ednParser) accept(s string) bool {
+	if !strings.HasPrefix(p.str[p.pos:], s) {
+		return false
+	}
+	p.pos += len(s)
+	return true
+}
+
+func (p *ednParser) acceptWord(s string) bool {
+	if !strings.HasPrefix(p.str[p.pos:], s) {
+		return false
+	}
+	if n := p.pos + len(s); n < len(p.str) && isLetter(p.str[n]) {
+		return false
+	}
+	p.pos += len(s)
+	return true
+}
+
+func (p *ednParser) peek() byte {
+	if p.done() {
+		return 0
+	}
+	return p.str[p.pos]
+}
+
+func (p *ednParser) done() bool {
+	return p.pos >= len(p.str)
+}
+
+func (p *ednParser) errorf(pattern string, args ...interface{}) error {
+	return &SyntaxError{msg: fmt.Sprintf(pattern, args...), Offset: int64(p.pos)}
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isLetter(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
@@ -0,0 +1,123 @@
+package cbor
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+)
+
+func TestParseDiagnostic(t *testing.T) {
+	data := []struct {
+		Diag string
+		Want string
+	}{
+		{Diag: "0", Want: "00"},
+		{Diag: "24", Want: "1818"},
+		{Diag: "-1", Want: "20"},
+		{Diag: "-1000", Want: "3903e7"},
+		{Diag: "0x1f", Want: "181f"},
+		{Diag: "0b101", Want: "05"},
+		{Diag: "0o17", Want: "0f"},
+		{Diag: "-0x10", Want: "2f"},
+		{Diag: "18446744073709551615", Want: "1bffffffffffffffff"},
+		{Diag: "18446744073709551616", Want: "c249010000000000000000"},
+		{Diag: "-18446744073709551616", Want: "3bffffffffffffffff"},
+		{Diag: "-18446744073709551617", Want: "c349010000000000000000"},
+		{Diag: "1_1", Want: "190001"},
+		{Diag: "1.5", Want: "f93e00"},
+		{Diag: "1.5_3", Want: "fb3ff8000000000000"},
+		{Diag: "1e5", Want: "fa47c35000"},
+		{Diag: "-0.0", Want: "f98000"},
+		{Diag: "NaN", Want: "f97e00"},
+		{Diag: "-Infinity", Want: "f9fc00"},
+		{Diag: "true false null undefined", Want: "f5f4f6f7"},
+		{Diag: "simple(16), simple(255)", Want: "f0f8ff"},
+		{Diag: "\"\\u00fc\\ud800\\udd51\"", Want: "66c3bcf0908591"},
+		{Diag: "'hello'", Want: "4568656c6c6f"},
+		{Diag: "h'68 65 6c / comment / 6c 6f'", Want: "4568656c6c6f"},
+		{Diag: "b64'aGVsbG8'", Want: "4568656c6c6f"},
+		{Diag: "b64'aGVsbG8='", Want: "4568656c6c6f"},
+		{Diag: "b32'NBSWY3DP'", Want: "4568656c6c6f"},
+		{Diag: "h32'D1IMOR3F'", Want: "4568656c6c6f"},
+		{Diag: "'he' h'6c' \"lo\"", Want: "4568656c6c6f"},
+		{Diag: "\"hel\" + \"lo\"", Want: "6568656c6c6f"},
+		{Diag: "<<1, [2]>>", Want: "43018102"},
+		{Diag: "24(<<\"IETF\">>)", Want: "d818456449455446"},
+		{Diag: "[1, # one\n 2 / two /]", Want: "820102"},
+		{Diag: "{_ \"a\": 1, \"b\": [_ ]}", Want: "bf61610161629fffff"},
+		{Diag: "[_1 ]", Want: "990000"},
+		{Diag: "(_ h'01', '')", Want: "5f410140ff"},
+		{Diag: "''_", Want: "5fff"},
+		{Diag: "\"a\"_0", Want: "780161"},
+		{Diag: "1_0(2)", Want: "d80102"},
+	}
+	for i, d := range data {
+		got, err := ParseDiagnostic(d.Diag)
+		if err != nil {
+			t.Errorf("%d: fail to parse %s: %s", i+1, d.Diag, err)
+			continue
+		}
+		if s := hex.EncodeToString(got); s != d.Want {
+			t.Errorf("%d: %s: want %s, got %s", i+1, d.Diag, d.Want, s)
+		}
+	}
+}
+
+func TestParseDiagnosticInvalid(t *testing.T) {
+	data := []string{
+		"[1, 2",
+		"{1}",
+		"[1 2]",
+		"\"abc",
+		"h'0'",
+		"256_0",
+		"1.1_1",
+		"(_ \"a\", h'01')",
+		"(_ 1)",
+		"-1(2)",
+		"simple(24)",
+		"foo",
+		"/ unterminated",
+		"\"\\ud800\"",
+		"<<1, 2",
+		"'\xff'_ ",
+	}
+	for i, d := range data {
+		if _, err := ParseDiagnostic(d); err == nil {
+			t.Errorf("%d: expected error for %s", i+1, d)
+		}
+	}
+}
+
+func TestParseDiagnosticRoundTrip(t *testing.T) {
+	data := []string{
+		"00", "1818", "1800", "190018", "1b000000e8d4a51000", "3bffffffffffffffff", "3a00000001",
+		"40", "4401020304", "5f42010243030405ff", "5fff", "7fff", "780161",
+		"6449455446", "62225c", "63e6b0b4", "64f0908591", "6400090a7f", "7f657374726561646d696e67ff",
+		"80", "83010203", "9803010203", "9f018202039f0405ffff",
+		"a0", "a26161016162820203", "bf61610161629f0203ffff", "b9000101f6",
+		"c074323031332d30332d32315432303a30343a30305a", "c11a514b67b0", "d82076687474703a2f2f7777772e6578616d706c652e636f6d",
+		"d80101", "d818456449455446",
+		"f4", "f5", "f6", "f7", "f0", "f8ff",
+		"f90000", "f98000", "f93c00", "f97bff", "f90001", "f97c00", "f97e00", "f9fc00",
+		"fa47c35000", "fa7f7fffff", "fa7fc00000", "fa3fc00000",
+		"fb3ff199999999999a", "fb7e37e43c8800759c", "fb7ff0000000000000", "fb3ff8000000000000",
+		"010203", "a1f5f4f6",
+	}
+	for i, d := range data {
+		raw, _ := hex.DecodeString(d)
+		var w bytes.Buffer
+		if err := Debug(&w, raw); err != nil {
+			t.Errorf("%d: fail to debug %s: %s", i+1, d, err)
+			continue
+		}
+		got, err := ParseDiagnostic(w.String())
+		if err != nil {
+			t.Errorf("%d: fail to parse %s: %s", i+1, w.String(), err)
+			continue
+		}
+		if !bytes.Equal(got, raw) {
+			t.Errorf("%d: %s: want %s, got %x", i+1, w.String(), d, got)
+		}
+	}
+}
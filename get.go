@@ -0,0 +1,175 @@
+package cbor
+
+import (
+	"bytes"
+	"fmt"
+	"sync"
+)
+
+// Get returns the item of data found at path. The segments of path are the
+// keys of map entries, given as Value or any Go value accepted by Marshal,
+// and the indexes of array elements, given as integers.
+//
+// The encoded bytes are walked without decoding the items that are not on
+// the path. The returned RawMessage is a sub slice of data. Get fails with
+// an error wrapping ErrNotFound if no item exists at path.
+func Get(data []byte, path ...interface{}) (RawMessage, error) {
+	p := make(Path, 0, len(path))
+	for _, x := range path {
+		v, err := toValue(x)
+		if err != nil {
+			return nil, err
+		}
+		p = append(p, v)
+	}
+	off, err := walk(data, p)
+	if err != nil {
+		return nil, err
+	}
+	end, err := skipBytes(data, off)
+	if err != nil {
+		return nil, err
+	}
+	return RawMessage(data[off:end]), nil
+}
+
+// UnmarshalPath decodes the item of data found at path into v. See Get for
+// the segments of path.
+func UnmarshalPath(data []byte, v interface{}, path ...interface{}) error {
+	raw, err := Get(data, path...)
+	if err != nil {
+		return err
+	}
+	return Unmarshal(raw, v)
+}
+
+// walk returns the offset of the item of data at path p.
+func walk(data []byte, p Path) (int, error) {
+	var off int
+	for i, k := range p {
+		h, next, err := headerAt(data, off)
+		if err != nil {
+			return 0, err
+		}
+		switch h.Major {
+		case Map:
+			off, err = walkMap(data, next, h.Indefinite(), h.Arg, segmentOf(k))
+		case Array:
+			if k.kind != KindUint {
+				return 0, fmt.Errorf("cbor: %s: expected index, got %s", p[:i+1], k.kind)
+			}
+			off, err = walkArray(data, next, h.Indefinite(), h.Arg, k.num)
+		default:
+			return 0, fmt.Errorf("cbor: %s: can not index %s", p[:i+1], majorName(h.Major))
+		}
+		if err == ErrNotFound {
+			err = fmt.Errorf("%w: %s", ErrNotFound, p[:i+1])
+		}
+		if err != nil {
+			return 0, err
+		}
+	}
+	return off, nil
+}
+
+// walkMap returns the offset of the value of the entry with the key k in the
+// map whose entries start at off.
+func walkMap(data []byte, off int, indef bool, n uint64, k segment) (int, error) {
+	for i := uint64(0); indef || i < n; i++ {
+		if indef && off < len(data) && data[off] == Break {
+			break
+		}
+		end, err := skipBytes(data, off)
+		if err != nil {
+			return 0, err
+		}
+		if k.match(data[off:end]) {
+			return end, nil
+		}
+		if off, err = skipBytes(data, end); err != nil {
+			return 0, err
+		}
+	}
+	return 0, ErrNotFound
+}
+
+// walkArray returns the offset of the element at index ix of the array whose
+// elements start at off.
+func walkArray(data []byte, off int, indef bool, n, ix uint64) (int, error) {
+	if !indef && ix >= n {
+		return 0, ErrNotFound
+	}
+	for i := uint64(0); i < ix; i++ {
+		if indef && off < len(data) && data[off] == Break {
+			return 0, ErrNotFound
+		}
+		end, err := skipBytes(data, off)
+		if err != nil {
+			return 0, err
+		}
+		off = end
+	}
+	if indef && off < len(data) && data[off] == Break {
+		return 0, ErrNotFound
+	}
+	return off, nil
+}
+
+// segment is a key of a map prepared to be compared with encoded keys.
+type segment struct {
+	key     Value
+	enc     []byte
+	major   byte
+	arg     uint64
+	payload []byte
+}
+
+func segmentOf(k Value) segment {
+	s := segment{key: k, enc: k.encode(nil, encodeDeterministic)}
+	h, next, _ := headerAt(s.enc, 0)
+	s.major, s.arg = h.Major, h.Arg
+	if h.Major == Bin || h.Major == String {
+		s.payload = s.enc[next:]
+	}
+	return s
+}
+
+// match reports whether the encoded key raw is equal to s. Integers and
+// definite length strings are compared without decoding them.
+func (s segment) match(raw []byte) bool {
+	h, next, err := headerAt(raw, 0)
+	if err != nil {
+		return false
+	}
+	switch m := h.Major; {
+	case m == Uint || m == Int:
+		return m == s.major && h.Arg == s.arg
+	case (m == Bin || m == String) && !h.Indefinite():
+		return m == s.major && bytes.Equal(raw[next:], s.payload)
+	case m != s.major:
+		return false
+	}
+	v, err := decodeOne(raw)
+	return err == nil && equalValues(v, s.key)
+}
+
+// skipBytes returns the offset following the item of data at offset off.
+// The readers given to skip are pooled so that it does not allocate.
+func skipBytes(data []byte, off int) (int, error) {
+	r := sliceReaderPool.Get().(*sliceReader)
+	*r = sliceReader{buf: data, pos: off}
+	_, err := skip(r, 1, nil)
+	end := r.pos
+	r.buf = nil
+	sliceReaderPool.Put(r)
+	if err != nil {
+		return 0, shiftError(unexpected(err), int64(off))
+	}
+	return end, nil
+}
+
+var sliceReaderPool = sync.Pool{
+	New: func() interface{} {
+		return new(sliceReader)
+	},
+}
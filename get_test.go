@@ -0,0 +1,97 @@
+package cbor
+
+import (
+	"encoding/hex"
+	"errors"
+	"testing"
+)
+
+func TestGet(t *testing.T) {
+	doc := `{
+		"name": "doc",
+		"items": [_ {"id": 1}, {"id": 2, "tags": ["a", "b"]}],
+		1: {h'00': true, -1: null, [1, 2]: "key"},
+		"long"_1: 24_1,
+		(_ "chun", "ked"): {"x": 0}
+	}`
+	data := []struct {
+		Path []interface{}
+		Want string
+	}{
+		{Path: nil, Want: doc},
+		{Path: []interface{}{"name"}, Want: `"doc"`},
+		{Path: []interface{}{"items", 0}, Want: `{"id": 1}`},
+		{Path: []interface{}{"items", 1, "tags", 1}, Want: `"b"`},
+		{Path: []interface{}{1, NewBytes([]byte{0})}, Want: `true`},
+		{Path: []interface{}{1, -1}, Want: `null`},
+		{Path: []interface{}{1, []int{1, 2}}, Want: `"key"`},
+		{Path: []interface{}{"long"}, Want: `24_1`},
+		{Path: []interface{}{"chunked", "x"}, Want: `0`},
+		{Path: []interface{}{NewText("items"), NewUint(1), NewText("id")}, Want: `2`},
+	}
+	bs := mustParse(t, doc)
+	for i, d := range data {
+		got, err := Get(bs, d.Path...)
+		if err != nil {
+			t.Errorf("%d: unexpected error: %s", i+1, err)
+			continue
+		}
+		want := mustParse(t, d.Want)
+		if hex.EncodeToString(got) != hex.EncodeToString(want) {
+			t.Errorf("%d: want %x, got %x", i+1, want, got)
+		}
+	}
+}
+
+func TestGetNotFound(t *testing.T) {
+	bs := mustParse(t, `{"a": [1, 2], "b": [_ 1]}`)
+	data := [][]interface{}{
+		{"c"},
+		{"a", 2},
+		{"b", 1},
+		{1},
+	}
+	for i, p := range data {
+		if _, err := Get(bs, p...); !errors.Is(err, ErrNotFound) {
+			t.Errorf("%d: expected ErrNotFound, got %v", i+1, err)
+		}
+	}
+	data = [][]interface{}{
+		{"a", "x"},
+		{"a", 0, 0},
+	}
+	for i, p := range data {
+		if _, err := Get(bs, p...); err == nil || errors.Is(err, ErrNotFound) {
+			t.Errorf("%d: expected error, got %v", i+1, err)
+		}
+	}
+	if _, err := Get(bs[:len(bs)-2], "b", 0); err == nil {
+		t.Errorf("expected error for truncated input")
+	}
+}
+
+func TestUnmarshalPath(t *testing.T) {
+	bs := mustParse(t, `{"items": [{"id": 1, "name": "one"}, {"id": 2, "name": "two"}]}`)
+	var item struct {
+		Id   int    `cbor:"id"`
+		Name string `cbor:"name"`
+	}
+	if err := UnmarshalPath(bs, &item, "items", 1); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if item.Id != 2 || item.Name != "two" {
+		t.Errorf("unexpected item: %+v", item)
+	}
+}
+
+func TestSkipBytesAllocs(t *testing.T) {
+	bs := mustParse(t, `[_ {"a": h'0102', "b": (_ "c", "d")}, 1(2), [1.5, -1, null]]`)
+	n := testing.AllocsPerRun(100, func() {
+		if end, err := skipBytes(bs, 0); err != nil || end != len(bs) {
+			t.Fatalf("unexpected result: %d, %v", end, err)
+		}
+	})
+	if n != 0 {
+		t.Errorf("skipBytes allocates %f times", n)
+	}
+}
@@ -0,0 +1,147 @@
+package cbor
+
+import (
+	"fmt"
+	"io"
+	"math"
+)
+
+// Header is the initial byte of a data item and its argument.
+//
+// Arg holds the value of unsigned integers, the value n of negative
+// integers -1-n, the length of strings, the number of elements of arrays
+// and of entries of maps, the number of tags, simple values and the bits of
+// floats. It is 0 for indefinite lengths and break codes.
+type Header struct {
+	Major byte
+	Info  byte
+	Arg   uint64
+}
+
+// ReadHeader reads the header of the next data item from r. A break code is
+// returned as a Header with a major type Other and an indefinite length.
+//
+// It returns io.EOF if r is empty and io.ErrUnexpectedEOF if r ends within
+// the header. Malformed headers give a *SyntaxError whose offset is the one
+// of the header: 0.
+func ReadHeader(r io.ByteReader) (Header, error) {
+	b, err := r.ReadByte()
+	if err != nil {
+		return Header{}, err
+	}
+	h, err := headerOf(b)
+	if err != nil {
+		return h, err
+	}
+	for i := 0; i < h.size(); i++ {
+		b, err := r.ReadByte()
+		if err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return h, err
+		}
+		h.Arg = h.Arg<<8 | uint64(b)
+	}
+	return h, nil
+}
+
+// headerOf returns the header starting with the initial byte b. Its argument
+// is set if it is given by the additional information.
+func headerOf(b byte) (Header, error) {
+	h := Header{Major: b & 0xE0, Info: b & 0x1F}
+	switch {
+	case h.Info < Len1:
+		h.Arg = uint64(h.Info)
+	case h.Info > Len8 && h.Info < Indefinite:
+		return h, &SyntaxError{msg: fmt.Sprintf("reserved additional information %d", h.Info)}
+	case h.Info == Indefinite && (h.Major == Uint || h.Major == Int || h.Major == Tag):
+		return h, &SyntaxError{msg: fmt.Sprintf("indefinite length not allowed for major type %d", h.Major>>5)}
+	}
+	return h, nil
+}
+
+// size returns the number of bytes of the argument following the initial
+// byte.
+func (h Header) size() int {
+	if h.Info < Len1 || h.Info > Len8 {
+		return 0
+	}
+	return 1 << (h.Info - Len1)
+}
+
+// length returns the argument of a string, array or map as an int. It fails
+// with ErrTooLarge if it does not fit.
+func (h Header) length() (int, error) {
+	if h.Arg > uint64(maxInt) {
+		return 0, ErrTooLarge
+	}
+	return int(h.Arg), nil
+}
+
+const maxInt = int(^uint(0) >> 1)
+
+// headerAt returns the header of the item of data starting at off and the
+// offset following it.
+func headerAt(data []byte, off int) (Header, int, error) {
+	r := sliceReader{buf: data, pos: off}
+	h, err := r.header()
+	if err != nil {
+		err = shiftError(err, int64(off))
+	}
+	return h, r.pos, err
+}
+
+// shiftError adds off to the offset of the syntax errors of ReadHeader.
+func shiftError(err error, off int64) error {
+	if e, ok := err.(*SyntaxError); ok {
+		e.Offset += off
+	}
+	return err
+}
+
+// Indefinite reports whether h starts an indefinite length string, array or
+// map, or is a break code.
+func (h Header) Indefinite() bool {
+	return h.Info == Indefinite
+}
+
+// IsBreak reports whether h is the break code ending an indefinite length
+// item.
+func (h Header) IsBreak() bool {
+	return h.Major == Other && h.Info == Indefinite
+}
+
+// IsFloat reports whether h is a float.
+func (h Header) IsFloat() bool {
+	return h.Major == Other && (h.Info == Float16 || h.Info == Float32 || h.Info == Float64)
+}
+
+// Int returns the value of an unsigned or negative integer. It fails with
+// ErrOutOfRange if the integer does not fit an int64.
+func (h Header) Int() (int64, error) {
+	if h.Major != Uint && h.Major != Int {
+		return 0, fmt.Errorf("cbor: expected integer, got major type %d", h.Major>>5)
+	}
+	if h.Arg > math.MaxInt64 {
+		return 0, ErrOutOfRange
+	}
+	if h.Major == Int {
+		return -1 - int64(h.Arg), nil
+	}
+	return int64(h.Arg), nil
+}
+
+// Float returns the value of a half, single or double precision float.
+func (h Header) Float() (float64, error) {
+	switch {
+	case h.Major != Other:
+	case h.Info == Float16:
+		return float16frombits(uint16(h.Arg)), nil
+	case h.Info == Float32:
+		return float64(math.Float32frombits(uint32(h.Arg))), nil
+	case h.Info == Float64:
+		return math.Float64frombits(h.Arg), nil
+	}
+	return 0, fmt.Errorf("cbor: expected float, got major type %d", h.Major>>5)
+}
@@ -0,0 +1,111 @@
+package cbor
+
+import (
+	"bytes"
+	"encoding/hex"
+	"io"
+	"math"
+	"testing"
+)
+
+func TestReadHeader(t *testing.T) {
+	data := []struct {
+		Raw  string
+		Want Header
+	}{
+		{Raw: "00", Want: Header{Major: Uint, Info: 0, Arg: 0}},
+		{Raw: "17", Want: Header{Major: Uint, Info: 23, Arg: 23}},
+		{Raw: "1818", Want: Header{Major: Uint, Info: Len1, Arg: 24}},
+		{Raw: "1903e8", Want: Header{Major: Uint, Info: Len2, Arg: 1000}},
+		{Raw: "1a000f4240", Want: Header{Major: Uint, Info: Len4, Arg: 1000000}},
+		{Raw: "1bffffffffffffffff", Want: Header{Major: Uint, Info: Len8, Arg: math.MaxUint64}},
+		{Raw: "3863", Want: Header{Major: Int, Info: Len1, Arg: 99}},
+		{Raw: "5818", Want: Header{Major: Bin, Info: Len1, Arg: 24}},
+		{Raw: "7f", Want: Header{Major: String, Info: Indefinite}},
+		{Raw: "98ff", Want: Header{Major: Array, Info: Len1, Arg: 255}},
+		{Raw: "bf", Want: Header{Major: Map, Info: Indefinite}},
+		{Raw: "d820", Want: Header{Major: Tag, Info: Len1, Arg: 32}},
+		{Raw: "f0", Want: Header{Major: Other, Info: 16, Arg: 16}},
+		{Raw: "f8ff", Want: Header{Major: Other, Info: Simple, Arg: 255}},
+		{Raw: "f93c00", Want: Header{Major: Other, Info: Float16, Arg: 0x3c00}},
+		{Raw: "ff", Want: Header{Major: Other, Info: Indefinite}},
+	}
+	for i, d := range data {
+		bs, _ := hex.DecodeString(d.Raw)
+		r := bytes.NewReader(bs)
+		h, err := ReadHeader(r)
+		if err != nil {
+			t.Errorf("%d: unexpected error: %s", i+1, err)
+			continue
+		}
+		if h != d.Want {
+			t.Errorf("%d: want %+v, got %+v", i+1, d.Want, h)
+		}
+		if r.Len() != 0 {
+			t.Errorf("%d: %d bytes left unread", i+1, r.Len())
+		}
+	}
+}
+
+func TestReadHeaderErrors(t *testing.T) {
+	data := []struct {
+		Raw string
+		Err error
+	}{
+		{Raw: "", Err: io.EOF},
+		{Raw: "19", Err: io.ErrUnexpectedEOF},
+		{Raw: "1a0102", Err: io.ErrUnexpectedEOF},
+		{Raw: "1c"},
+		{Raw: "5e"},
+		{Raw: "1f"},
+		{Raw: "3f"},
+		{Raw: "df"},
+	}
+	for i, d := range data {
+		bs, _ := hex.DecodeString(d.Raw)
+		_, err := ReadHeader(bytes.NewReader(bs))
+		if err == nil || (d.Err != nil && err != d.Err) {
+			t.Errorf("%d: unexpected error: want %v, got %v", i+1, d.Err, err)
+		}
+	}
+}
+
+func TestHeaderValues(t *testing.T) {
+	ints := []struct {
+		Header
+		Want int64
+		Err  bool
+	}{
+		{Header: Header{Major: Uint, Arg: 10}, Want: 10},
+		{Header: Header{Major: Int, Arg: 9}, Want: -10},
+		{Header: Header{Major: Int, Arg: math.MaxInt64}, Want: math.MinInt64},
+		{Header: Header{Major: Uint, Arg: math.MaxUint64}, Err: true},
+		{Header: Header{Major: String, Arg: 1}, Err: true},
+	}
+	for i, d := range ints {
+		got, err := d.Int()
+		if d.Err != (err != nil) || got != d.Want {
+			t.Errorf("%d: want %d, got %d (%v)", i+1, d.Want, got, err)
+		}
+	}
+	floats := []struct {
+		Header
+		Want float64
+	}{
+		{Header: Header{Major: Other, Info: Float16, Arg: 0x3e00}, Want: 1.5},
+		{Header: Header{Major: Other, Info: Float32, Arg: 0x47c35000}, Want: 100000},
+		{Header: Header{Major: Other, Info: Float64, Arg: 0x3ff199999999999a}, Want: 1.1},
+	}
+	for i, d := range floats {
+		if !d.IsFloat() {
+			t.Errorf("%d: header should be a float", i+1)
+		}
+		got, err := d.Float()
+		if err != nil || got != d.Want {
+			t.Errorf("%d: want %f, got %f (%v)", i+1, d.Want, got, err)
+		}
+	}
+	if _, err := (Header{Major: Other, Info: True}).Float(); err == nil {
+		t.Errorf("expected error for true")
+	}
+}
@@ -1,166 +1,321 @@
 package cbor
 
 import (
-	"bytes"
-	"encoding/binary"
 	"io"
-	"math"
 	"reflect"
+	"strings"
+	"sync"
 	"unicode/utf8"
 )
 
+// Marshal returns the CBOR encoding of v.
+//
+// Floats are written with the shortest of the half, single and double
+// precision widths that holds their value exactly, whatever their Go type.
+// NaN is always written as a half precision quiet NaN: its payload is not
+// kept.
 func Marshal(v interface{}) ([]byte, error) {
-	var b bytes.Buffer
-	if err := marshal(&b, reflect.ValueOf(v)); err != nil {
+	e := getEncoder()
+	defer putEncoder(e)
+	if err := marshal(e, reflect.ValueOf(v)); err != nil {
 		return nil, err
 	}
-	return b.Bytes(), nil
+	return append([]byte(nil), e.buf...), nil
 }
 
-func marshal(b *bytes.Buffer, v reflect.Value) error {
-	switch v.Kind() {
+// AppendMarshal appends the encoding of v to dst and returns the extended
+// buffer. It does not allocate if dst has enough capacity. On error, dst is
+// returned unchanged.
+func AppendMarshal(dst []byte, v interface{}) ([]byte, error) {
+	e := getEncoder()
+	// the pooled buffer is set aside while the encoder appends to dst
+	buf := e.buf
+	e.buf = dst
+	err := marshal(e, reflect.ValueOf(v))
+	out := e.buf
+	e.buf = buf
+	putEncoder(e)
+	if err != nil {
+		return dst, err
+	}
+	return out, nil
+}
+
+// Encoder writes CBOR items to an output stream.
+type Encoder struct {
+	w    io.Writer
+	buf  []byte
+	utf8 UTF8Policy
+
+	// scratch holds the headers written by the Write methods
+	scratch [9]byte
+}
+
+var encoderPool = sync.Pool{
+	New: func() interface{} {
+		return &Encoder{buf: make([]byte, 0, 512)}
+	},
+}
+
+func getEncoder() *Encoder {
+	return encoderPool.Get().(*Encoder)
+}
+
+// putEncoder returns e to the pool unless its buffer grew too large to be
+// worth keeping.
+func putEncoder(e *Encoder) {
+	if cap(e.buf) > 64<<10 {
+		return
+	}
+	e.buf = e.buf[:0]
+	encoderPool.Put(e)
+}
+
+func NewEncoder(w io.Writer) *Encoder {
+	return &Encoder{w: w}
+}
+
+// SetUTF8Policy sets how the Encoder handles Go strings that are not valid
+// UTF-8. The default is UTF8Binary.
+func (e *Encoder) SetUTF8Policy(p UTF8Policy) {
+	e.utf8 = p
+}
+
+func (e *Encoder) Encode(v interface{}) error {
+	defer func() {
+		e.buf = e.buf[:0]
+	}()
+	if err := marshal(e, reflect.ValueOf(v)); err != nil {
+		return err
+	}
+	_, err := e.w.Write(e.buf)
+	return err
+}
+
+// header appends the shortest header of major type m and argument v.
+func (e *Encoder) header(m byte, v uint64) {
+	e.buf = appendHeader(e.buf, m, infoOf(v), v)
+}
+
+func marshal(e *Encoder, v reflect.Value) error {
+	if !v.IsValid() {
+		e.buf = append(e.buf, Other|Undefined)
+		return nil
+	}
+	return typeEncoder(v.Type())(e, v)
+}
+
+func newTypeEncoder(t reflect.Type) encoderFunc {
+	switch t {
+	case rawType:
+		return encodeRaw
+	case valueType:
+		return encodeValue
+	case orderedMapType:
+		return encodeOrderedMap
+	}
+	switch k := t.Kind(); k {
 	default:
-		return UnsupportedError(v.Kind().String())
-	case reflect.Invalid:
-		binary.Write(b, binary.BigEndian, Other|Undefined)
-	case reflect.Ptr:
-		if v.IsNil() {
-			binary.Write(b, binary.BigEndian, Other|Nil)
-		} else {
-			return marshal(b, v.Elem())
+		return func(*Encoder, reflect.Value) error {
+			return UnsupportedError(k.String())
 		}
+	case reflect.Ptr:
+		return newPtrEncoder(t)
 	case reflect.Interface:
-		return marshal(b, reflect.ValueOf(v.Interface()))
+		return encodeInterface
 	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
-		return encodeNumber(b, Uint, v.Uint())
+		return encodeUint
 	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
-		if i := v.Int(); i >= 0 {
-			return encodeNumber(b, Uint, uint64(i))
-		} else {
-			return encodeNumber(b, Int, uint64(-i-1))
-		}
-	case reflect.Float32:
-		v := math.Float32bits(float32(v.Float()))
-		binary.Write(b, binary.BigEndian, Other|Float32)
-		binary.Write(b, binary.BigEndian, v)
-	case reflect.Float64:
-		v := math.Float64bits(v.Float())
-		binary.Write(b, binary.BigEndian, Other|Float64)
-		binary.Write(b, binary.BigEndian, v)
+		return encodeInt
+	case reflect.Float32, reflect.Float64:
+		return encodeFloat
 	case reflect.Bool:
-		i := byte(Other | False)
-		if v.Bool() {
-			i = byte(Other | True)
-		}
-		binary.Write(b, binary.BigEndian, i)
+		return encodeBool
 	case reflect.String:
-		s, t := v.String(), String
-		if !utf8.ValidString(s) {
-			t = Bin
+		return encodeText
+	case reflect.Slice, reflect.Array:
+		return newArrayEncoder(t)
+	case reflect.Map:
+		return newMapEncoder(t)
+	case reflect.Struct:
+		return newStructEncoder(t)
+	}
+}
+
+func encodeRaw(e *Encoder, v reflect.Value) error {
+	if v.Len() == 0 {
+		e.buf = append(e.buf, Other|Nil)
+	} else {
+		e.buf = append(e.buf, v.Bytes()...)
+	}
+	return nil
+}
+
+func encodeValue(e *Encoder, v reflect.Value) error {
+	e.buf = v.Interface().(Value).append(e.buf)
+	return nil
+}
+
+func encodeOrderedMap(e *Encoder, v reflect.Value) error {
+	m := v.Interface().(OrderedMap)
+	e.buf = m.append(e.buf)
+	return nil
+}
+
+func encodeInterface(e *Encoder, v reflect.Value) error {
+	return marshal(e, reflect.ValueOf(v.Interface()))
+}
+
+func newPtrEncoder(t reflect.Type) encoderFunc {
+	elem := typeEncoder(t.Elem())
+	return func(e *Encoder, v reflect.Value) error {
+		if v.IsNil() {
+			e.buf = append(e.buf, Other|Nil)
+			return nil
 		}
-		if err := encodeString(b, t, s); err != nil {
-			return err
+		return elem(e, v.Elem())
+	}
+}
+
+func encodeUint(e *Encoder, v reflect.Value) error {
+	e.header(Uint, v.Uint())
+	return nil
+}
+
+func encodeInt(e *Encoder, v reflect.Value) error {
+	if i := v.Int(); i >= 0 {
+		e.header(Uint, uint64(i))
+	} else {
+		e.header(Int, uint64(-i-1))
+	}
+	return nil
+}
+
+// encodeFloat writes floats with the shortest width that holds their value.
+func encodeFloat(e *Encoder, v reflect.Value) error {
+	f := v.Float()
+	e.buf = appendFloat(e.buf, f, floatSize(f))
+	return nil
+}
+
+func encodeBool(e *Encoder, v reflect.Value) error {
+	if v.Bool() {
+		e.buf = append(e.buf, Other|True)
+	} else {
+		e.buf = append(e.buf, Other|False)
+	}
+	return nil
+}
+
+func encodeText(e *Encoder, v reflect.Value) error {
+	s, t := v.String(), String
+	if !utf8.ValidString(s) {
+		switch e.utf8 {
+		case UTF8Binary:
+			t = Bin
+		case UTF8Replace:
+			s = strings.ToValidUTF8(s, string(utf8.RuneError))
+		default:
+			return ErrInvalidUTF8
 		}
-	case reflect.Slice, reflect.Array:
+	}
+	e.header(t, uint64(len(s)))
+	e.buf = append(e.buf, s...)
+	return nil
+}
+
+func newArrayEncoder(t reflect.Type) encoderFunc {
+	if t.Elem().Kind() == reflect.Uint8 {
+		return encodeBytes
+	}
+	elem := typeEncoder(t.Elem())
+	return func(e *Encoder, v reflect.Value) error {
 		z := v.Len()
-		if err := encodeLength(b, Array, uint64(z)); err != nil {
-			return err
-		}
+		e.header(Array, uint64(z))
 		for i := 0; i < z; i++ {
-			if err := marshal(b, v.Index(i)); err != nil {
+			if err := elem(e, v.Index(i)); err != nil {
 				return err
 			}
 		}
-	case reflect.Map:
-		z := v.Len()
-		if err := encodeLength(b, Map, uint64(z)); err != nil {
-			return err
-		}
-		for i, vs := 0, v.MapKeys(); i < z; i++ {
-			if err := marshal(b, vs[i]); err != nil {
+		return nil
+	}
+}
+
+// encodeBytes writes slices and arrays of bytes as byte strings.
+func encodeBytes(e *Encoder, v reflect.Value) error {
+	z := v.Len()
+	e.header(Bin, uint64(z))
+	if v.Kind() == reflect.Slice || v.CanAddr() {
+		e.buf = append(e.buf, v.Bytes()...)
+		return nil
+	}
+	for i := 0; i < z; i++ {
+		e.buf = append(e.buf, byte(v.Index(i).Uint()))
+	}
+	return nil
+}
+
+func newMapEncoder(t reflect.Type) encoderFunc {
+	var (
+		key  = typeEncoder(t.Key())
+		elem = typeEncoder(t.Elem())
+	)
+	return func(e *Encoder, v reflect.Value) error {
+		e.header(Map, uint64(v.Len()))
+		for it := v.MapRange(); it.Next(); {
+			if err := key(e, it.Key()); err != nil {
 				return err
 			}
-			if err := marshal(b, v.MapIndex(vs[i])); err != nil {
+			if err := elem(e, it.Value()); err != nil {
 				return err
 			}
 		}
-	case reflect.Struct:
-		z, t := v.NumField(), v.Type()
-		if err := encodeLength(b, Map, uint64(z)); err != nil {
-			return err
+		return nil
+	}
+}
+
+// newStructEncoder returns the encoder of the struct type t. The keys of its
+// fields are written from their precomputed encoding.
+func newStructEncoder(t reflect.Type) encoderFunc {
+	var (
+		c    = cachedStruct(t)
+		encs = make([]encoderFunc, len(c.fields))
+	)
+	if c.err != nil {
+		return func(*Encoder, reflect.Value) error {
+			return c.err
 		}
-		for i := 0; i < z; i++ {
-			f := t.Field(i)
-			if len(f.PkgPath) > 0 {
-				continue
-			}
-			n := f.Name
-			if t := f.Tag.Get("cbor"); len(t) > 0 {
-				n = t
+	}
+	for i, f := range c.fields {
+		encs[i] = typeEncoder(t.Field(f.index).Type)
+	}
+	return func(e *Encoder, v reflect.Value) error {
+		var (
+			extra reflect.Value
+			z     = len(c.fields)
+		)
+		if c.extra >= 0 {
+			extra = v.Field(c.extra)
+			z += extra.Len()
+		}
+		e.header(Map, uint64(z))
+		for i, f := range c.fields {
+			e.buf = append(e.buf, f.key...)
+			if err := encs[i](e, v.Field(f.index)); err != nil {
+				return err
 			}
-			if err := encodeString(b, String, n); err != nil {
+		}
+		if !extra.IsValid() {
+			return nil
+		}
+		for it := extra.MapRange(); it.Next(); {
+			if err := marshal(e, it.Key()); err != nil {
 				return err
 			}
-			if err := marshal(b, v.Field(i)); err != nil {
+			if err := marshal(e, it.Value()); err != nil {
 				return err
 			}
 		}
+		return nil
 	}
-	return nil
-}
-
-func encodeLength(w io.Writer, t byte, z uint64) error {
-	switch {
-	default:
-		return ErrTooLarge
-	case z < uint64(Len1):
-		binary.Write(w, binary.BigEndian, t|byte(z))
-	case z <= math.MaxUint8:
-		binary.Write(w, binary.BigEndian, t|Len1)
-		binary.Write(w, binary.BigEndian, uint8(z))
-	case z <= math.MaxUint16:
-		binary.Write(w, binary.BigEndian, t|Len2)
-		binary.Write(w, binary.BigEndian, uint16(z))
-	case z <= math.MaxUint32:
-		binary.Write(w, binary.BigEndian, t|Len4)
-		binary.Write(w, binary.BigEndian, uint32(z))
-	case z <= math.MaxUint64:
-		binary.Write(w, binary.BigEndian, t|Len8)
-		binary.Write(w, binary.BigEndian, uint64(z))
-	}
-	return nil
-}
-
-func encodeString(w io.Writer, t byte, v string) error {
-	r := []byte(v)
-	if err := encodeLength(w, t, uint64(len(r))); err != nil {
-		return err
-	}
-	if len(r) > 0 {
-		_, err := w.Write(r)
-		return err
-	}
-	return nil
-}
-
-func encodeNumber(w io.Writer, t byte, v uint64) error {
-	switch {
-	default:
-		return ErrOutOfRange
-	case v < uint64(Len1):
-		binary.Write(w, binary.BigEndian, t|byte(v))
-	case v <= math.MaxUint8:
-		binary.Write(w, binary.BigEndian, t|Len1)
-		binary.Write(w, binary.BigEndian, uint8(v))
-	case v <= math.MaxUint16:
-		binary.Write(w, binary.BigEndian, t|Len2)
-		binary.Write(w, binary.BigEndian, uint16(v))
-	case v <= math.MaxUint32:
-		binary.Write(w, binary.BigEndian, t|Len4)
-		binary.Write(w, binary.BigEndian, uint32(v))
-	case v <= math.MaxUint64:
-		binary.Write(w, binary.BigEndian, t|Len8)
-		binary.Write(w, binary.BigEndian, uint64(v))
-	}
-	return nil
 }
@@ -1,7 +1,9 @@
 package cbor
 
 import (
+	"bytes"
 	"fmt"
+	"math"
 	"testing"
 )
 
@@ -62,6 +64,9 @@ func TestMarshalFloat(t *testing.T) {
 		{Value: float32(1.5), Want: "0xf93e00"},
 		{Value: float32(65504.0), Want: "0xf97bff"},
 		{Value: float32(100000.0), Want: "0xfa47c35000"},
+		{Value: float64(1.5), Want: "0xf93e00"},
+		{Value: float64(100000.0), Want: "0xfa47c35000"},
+		{Value: math.Float64frombits(0x7ff0000000000001), Want: "0xf97e00"},
 	}
 	testMarshal(t, data)
 }
@@ -71,6 +76,11 @@ func TestMarshalArray(t *testing.T) {
 		{Value: []int{}, Want: "0x80"},
 		{Value: []int{1, 2, 3}, Want: "0x83010203"},
 		{Value: []interface{}{"a", map[string]string{"b": "c"}}, Want: "0x826161a161626163"},
+		{Value: []byte{}, Want: "0x40"},
+		{Value: []byte{1, 2}, Want: "0x420102"},
+		{Value: [3]byte{1, 2, 3}, Want: "0x43010203"},
+		{Value: &[2]uint8{4, 5}, Want: "0x420405"},
+		{Value: [][]byte{{1}, nil}, Want: "0x82410140"},
 	}
 	testMarshal(t, data)
 }
@@ -82,6 +92,52 @@ func TestMarshalMap(t *testing.T) {
 	testMarshal(t, data)
 }
 
+func TestMarshalInvalidUTF8(t *testing.T) {
+	data := []struct {
+		Policy UTF8Policy
+		Want   string
+	}{
+		{Policy: UTF8Binary, Want: "0x4361ff62"},
+		{Policy: UTF8Replace, Want: "0x6561efbfbd62"},
+		{Policy: UTF8Reject},
+	}
+	for i, d := range data {
+		var (
+			buf bytes.Buffer
+			e   = NewEncoder(&buf)
+		)
+		e.SetUTF8Policy(d.Policy)
+		err := e.Encode("a\xffb")
+		if d.Want == "" {
+			if err != ErrInvalidUTF8 {
+				t.Errorf("%d: expected %v, got %v", i+1, ErrInvalidUTF8, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%d: encode fail: %v", i+1, err)
+			continue
+		}
+		if s := fmt.Sprintf("%#x", buf.Bytes()); s != d.Want {
+			t.Errorf("%d: want: %s, got: %s", i+1, d.Want, s)
+		}
+	}
+}
+
+func TestMarshalRaw(t *testing.T) {
+	type ab struct {
+		A RawMessage `cbor:"a"`
+		B int        `cbor:"-"`
+		c int
+	}
+	data := []testunit{
+		{Value: RawMessage{0x83, 0x01, 0x02, 0x03}, Want: "0x83010203"},
+		{Value: RawMessage(nil), Want: "0xf6"},
+		{Value: ab{A: RawMessage{0xf5}, B: 1, c: 2}, Want: "0xa16161f5"},
+	}
+	testMarshal(t, data)
+}
+
 func testMarshal(t *testing.T, data []testunit) {
 	for i, d := range data {
 		got, err := Marshal(d.Value)
@@ -98,3 +154,41 @@ func testMarshal(t *testing.T, data []testunit) {
 		}
 	}
 }
+
+func TestAppendMarshal(t *testing.T) {
+	type point struct {
+		Name string `cbor:"name"`
+		X, Y int
+		Z    float64
+		Ok   bool
+	}
+	var (
+		p    = &point{Name: "p", X: 1, Y: -2, Z: 1.5, Ok: true}
+		want = "0xa5646e616d656170615801615921615af93e00624f6bf5"
+	)
+	dst := []byte{0x82}
+	got, err := AppendMarshal(dst, p)
+	if err != nil {
+		t.Fatalf("append fail: %s", err)
+	}
+	if s := fmt.Sprintf("%#x", got); s != "0x82"+want[2:] {
+		t.Errorf("want %s, got %s", "0x82"+want[2:], s)
+	}
+	if bs, _ := Marshal(p); fmt.Sprintf("%#x", bs) != want {
+		t.Errorf("marshal: want %s, got %#x", want, bs)
+	}
+	if got, err := AppendMarshal(dst, []interface{}{1, make(chan int)}); err == nil || fmt.Sprintf("%#x", got) != "0x82" {
+		t.Errorf("error: want 0x82 unchanged, got %#x (%v)", got, err)
+	}
+
+	buf := make([]byte, 0, 64)
+	allocs := testing.AllocsPerRun(100, func() {
+		buf, err = AppendMarshal(buf[:0], p)
+	})
+	if err != nil {
+		t.Fatalf("append fail: %s", err)
+	}
+	if allocs != 0 {
+		t.Errorf("AppendMarshal allocates %.0f times", allocs)
+	}
+}
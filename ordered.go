@@ -0,0 +1,243 @@
+package cbor
+
+import (
+	"bytes"
+	"reflect"
+	"sort"
+)
+
+// OrderedMap is a map that keeps its entries in the order they were decoded
+// or added. Its keys and values are Value and lookups use an index on the
+// encoded keys.
+//
+// The zero OrderedMap is an empty map ready to use.
+type OrderedMap struct {
+	keys   []Value
+	values []Value
+	index  map[string]int
+	enc    *encoding
+}
+
+var orderedMapType = reflect.TypeOf(OrderedMap{})
+
+func NewOrderedMap() *OrderedMap {
+	return &OrderedMap{}
+}
+
+func (m *OrderedMap) Len() int {
+	return len(m.keys)
+}
+
+// Keys returns the keys of m in order.
+func (m *OrderedMap) Keys() []Value {
+	return m.keys
+}
+
+// Get returns the value of the entry with the given key. The key can be a
+// Value or any Go value accepted by Marshal.
+func (m *OrderedMap) Get(key interface{}) (Value, bool) {
+	if i, ok := m.lookup(key); ok {
+		return m.values[i], true
+	}
+	return Value{}, false
+}
+
+// Set sets the value of the entry with the given key. A new entry is added
+// after the existing ones if m has no such key.
+func (m *OrderedMap) Set(key, val interface{}) error {
+	k, err := keyValue(key)
+	if err != nil {
+		return err
+	}
+	v, err := toValue(val)
+	if err != nil {
+		return err
+	}
+	m.set(k, v)
+	return nil
+}
+
+// Delete removes the entry with the given key and reports whether it was
+// found.
+func (m *OrderedMap) Delete(key interface{}) bool {
+	i, ok := m.lookup(key)
+	if !ok {
+		return false
+	}
+	delete(m.index, keyOf(m.keys[i]))
+	m.keys = append(m.keys[:i], m.keys[i+1:]...)
+	m.values = append(m.values[:i], m.values[i+1:]...)
+	for j := i; j < len(m.keys); j++ {
+		m.index[keyOf(m.keys[j])] = j
+	}
+	return true
+}
+
+// Range calls fn for each entry of m in order until fn returns false.
+func (m *OrderedMap) Range(fn func(k, v Value) bool) {
+	for i := range m.keys {
+		if !fn(m.keys[i], m.values[i]) {
+			return
+		}
+	}
+}
+
+// lookup returns the position of the entry with the given key.
+func (m *OrderedMap) lookup(key interface{}) (int, bool) {
+	var (
+		buf [32]byte
+		bs  []byte
+		ok  bool
+	)
+	switch k := key.(type) {
+	case Value:
+		bs = k.encode(nil, encodeDeterministic)
+	case *Value:
+		bs = k.encode(nil, encodeDeterministic)
+	default:
+		if bs, ok = appendKey(buf[:0], key); !ok {
+			k, err := toValue(key)
+			if err != nil {
+				return 0, false
+			}
+			bs = k.encode(nil, encodeDeterministic)
+		}
+	}
+	i, ok := m.index[string(bs)]
+	return i, ok
+}
+
+func (m *OrderedMap) set(k, v Value) {
+	if m.index == nil {
+		m.index = make(map[string]int)
+	}
+	z := keyOf(k)
+	if i, ok := m.index[z]; ok {
+		m.values[i] = v
+		return
+	}
+	m.index[z] = len(m.keys)
+	m.keys = append(m.keys, k)
+	m.values = append(m.values, v)
+}
+
+func (m *OrderedMap) append(bs []byte) []byte {
+	return m.encode(bs, encodeExact)
+}
+
+func (m *OrderedMap) encode(bs []byte, mode encodeMode) []byte {
+	indef := mode == encodeExact && m.enc != nil && m.enc.info == Indefinite
+	if indef {
+		bs = append(bs, Map|Indefinite)
+	} else {
+		z := uint64(m.Len())
+		bs = appendHeader(bs, Map, preferredInfo(m.enc, z, mode), z)
+	}
+	if mode == encodeDeterministic {
+		return m.sorted(bs)
+	}
+	for i := range m.keys {
+		bs = m.keys[i].encode(bs, mode)
+		bs = m.values[i].encode(bs, mode)
+	}
+	if indef {
+		bs = append(bs, Break)
+	}
+	return bs
+}
+
+// sorted appends the entries of m in the bytewise lexicographic order of
+// their deterministically encoded keys.
+func (m *OrderedMap) sorted(bs []byte) []byte {
+	type entry struct {
+		key, value []byte
+	}
+	es := make([]entry, len(m.keys))
+	for i := range m.keys {
+		es[i].key = m.keys[i].encode(nil, encodeDeterministic)
+		es[i].value = m.values[i].encode(nil, encodeDeterministic)
+	}
+	sort.Slice(es, func(i, j int) bool {
+		return bytes.Compare(es[i].key, es[j].key) < 0
+	})
+	for _, e := range es {
+		bs = append(bs, e.key...)
+		bs = append(bs, e.value...)
+	}
+	return bs
+}
+
+// keyOf returns the string used to index the key k: its deterministic
+// encoding.
+func keyOf(k Value) string {
+	return string(k.encode(nil, encodeDeterministic))
+}
+
+// appendKey appends the index key of key to bs when key is a string or an
+// integer, whose encoding does not need a round trip through Marshal.
+func appendKey(bs []byte, key interface{}) ([]byte, bool) {
+	switch k := key.(type) {
+	case string:
+		z := uint64(len(k))
+		return append(appendHeader(bs, String, infoOf(z), z), k...), true
+	case int:
+		return appendInt(bs, int64(k)), true
+	case int8:
+		return appendInt(bs, int64(k)), true
+	case int16:
+		return appendInt(bs, int64(k)), true
+	case int32:
+		return appendInt(bs, int64(k)), true
+	case int64:
+		return appendInt(bs, k), true
+	case uint:
+		return appendHeader(bs, Uint, infoOf(uint64(k)), uint64(k)), true
+	case uint8:
+		return appendHeader(bs, Uint, infoOf(uint64(k)), uint64(k)), true
+	case uint16:
+		return appendHeader(bs, Uint, infoOf(uint64(k)), uint64(k)), true
+	case uint32:
+		return appendHeader(bs, Uint, infoOf(uint64(k)), uint64(k)), true
+	case uint64:
+		return appendHeader(bs, Uint, infoOf(k), k), true
+	}
+	return bs, false
+}
+
+func appendInt(bs []byte, v int64) []byte {
+	if v >= 0 {
+		return appendHeader(bs, Uint, infoOf(uint64(v)), uint64(v))
+	}
+	z := uint64(-1 - v)
+	return appendHeader(bs, Int, infoOf(z), z)
+}
+
+// keyValue converts key to a Value like toValue but without going through
+// Marshal for strings and integers.
+func keyValue(key interface{}) (Value, error) {
+	switch k := key.(type) {
+	case string:
+		return NewText(k), nil
+	case int:
+		return NewInt(int64(k)), nil
+	case int8:
+		return NewInt(int64(k)), nil
+	case int16:
+		return NewInt(int64(k)), nil
+	case int32:
+		return NewInt(int64(k)), nil
+	case int64:
+		return NewInt(k), nil
+	case uint:
+		return NewUint(uint64(k)), nil
+	case uint8:
+		return NewUint(uint64(k)), nil
+	case uint16:
+		return NewUint(uint64(k)), nil
+	case uint32:
+		return NewUint(uint64(k)), nil
+	case uint64:
+		return NewUint(k), nil
+	}
+	return toValue(key)
+}
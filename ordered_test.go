@@ -0,0 +1,107 @@
+package cbor
+
+import (
+	"encoding/hex"
+	"testing"
+)
+
+func TestOrderedMap(t *testing.T) {
+	raw := "a461620161610263666f6f820304f5f6"
+	var m OrderedMap
+	if err := decodeAndUnmarshal(raw, &m); err != nil {
+		t.Fatalf("unmarshal fail: %v", err)
+	}
+	if m.Len() != 4 {
+		t.Fatalf("want 4 entries, got %d", m.Len())
+	}
+	var keys []string
+	for _, k := range m.Keys() {
+		keys = append(keys, k.String())
+	}
+	if got, want := keys, []string{`"b"`, `"a"`, `"foo"`, `true`}; len(got) != len(want) || got[0] != want[0] || got[1] != want[1] || got[2] != want[2] || got[3] != want[3] {
+		t.Errorf("keys mismatched: want %v, got %v", want, got)
+	}
+	if v, ok := m.Get("a"); !ok || v.String() != "2" {
+		t.Errorf("a: want 2, got %s", v)
+	}
+	if v, ok := m.Get(true); !ok || v.Kind() != KindNull {
+		t.Errorf("true: want null, got %s", v)
+	}
+	bs, err := Marshal(&m)
+	if err != nil {
+		t.Fatalf("marshal fail: %v", err)
+	}
+	if got := hex.EncodeToString(bs); got != raw {
+		t.Errorf("order not preserved: want %s, got %s", raw, got)
+	}
+
+	m.Set("a", 10)
+	m.Set(-1, "x")
+	if !m.Delete("b") || m.Delete("b") {
+		t.Errorf("delete should only succeed once")
+	}
+	want := `{"a": 10, "foo": [3, 4], true: null, -1: "x"}`
+	bs, _ = Marshal(m)
+	var v Value
+	if err := Unmarshal(bs, &v); err != nil {
+		t.Fatalf("unmarshal fail: %v", err)
+	}
+	if got := v.String(); got != want {
+		t.Errorf("want %s, got %s", want, got)
+	}
+	if v, ok := m.Get("foo"); !ok || v.Len() != 2 {
+		t.Errorf("foo: want [3, 4], got %s", v)
+	}
+}
+
+func TestOrderedMapField(t *testing.T) {
+	type doc struct {
+		Meta *OrderedMap `cbor:"meta"`
+	}
+	raw := "a1646d657461a2617a01616102"
+	var d doc
+	if err := decodeAndUnmarshal(raw, &d); err != nil {
+		t.Fatalf("unmarshal fail: %v", err)
+	}
+	bs, err := Marshal(d)
+	if err != nil {
+		t.Fatalf("marshal fail: %v", err)
+	}
+	if got := hex.EncodeToString(bs); got != raw {
+		t.Errorf("want %s, got %s", raw, got)
+	}
+	if err := decodeAndUnmarshal("a1646d657461a2616101616102", &d); err == nil {
+		t.Errorf("expected error for duplicate key")
+	}
+}
+
+func TestOrderedMapKeys(t *testing.T) {
+	// keys: "a", 1, -1, 500, 2.5, [1]
+	raw := "a66161f501f520f51901f4f5f94100f58101f5"
+	var m OrderedMap
+	if err := decodeAndUnmarshal(raw, &m); err != nil {
+		t.Fatalf("unmarshal fail: %v", err)
+	}
+	keys := []interface{}{"a", 1, int8(1), uint64(1), -1, int64(-1), uint16(500), int32(500), 2.5, []int{1}, NewUint(1), NewInt(-1)}
+	for _, k := range keys {
+		if _, ok := m.Get(k); !ok {
+			t.Errorf("%#v: key not found", k)
+		}
+	}
+	for _, k := range []interface{}{"b", 2, uint8(2), -2, 501} {
+		if _, ok := m.Get(k); ok {
+			t.Errorf("%#v: unexpected key found", k)
+		}
+	}
+	m.Set(uint32(1), false)
+	if v, _ := m.Get(1); m.Len() != 6 || v.String() != "false" {
+		t.Errorf("set: want 6 entries and false, got %d and %s", m.Len(), v)
+	}
+	if !m.Delete(int16(-1)) || m.Len() != 5 {
+		t.Errorf("delete -1 failed")
+	}
+	var k interface{} = 500
+	if n := testing.AllocsPerRun(100, func() { m.Get("a"); m.Get(k) }); n != 0 {
+		t.Errorf("get: want no allocations, got %v", n)
+	}
+}
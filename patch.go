@@ -0,0 +1,395 @@
+package cbor
+
+import (
+	"fmt"
+)
+
+// Operation is a single edit of a patch, modelled on JSON Patch (RFC 6902).
+// Op is one of "add", "remove", "replace", "move", "copy" and "test". The
+// segments of Path and From can be any key of a map or, for arrays, an index
+// given as an unsigned integer. The text "-" designates the end of an array
+// for "add", "move" and "copy".
+type Operation struct {
+	Op    string
+	Path  Path
+	From  Path
+	Value Value
+}
+
+// Patch is a list of operations applied in order.
+//
+// It is encoded as an array of maps with the text keys "op", "path", "from"
+// and "value". Paths are encoded as arrays of segments. "from" is only
+// written for "move" and "copy" and "value" for "add", "replace" and "test".
+type Patch []Operation
+
+// ParsePatch decodes the encoded patch held by bs.
+func ParsePatch(bs []byte) (Patch, error) {
+	v, err := decodeOne(bs)
+	if err != nil {
+		return nil, err
+	}
+	if v.kind != KindArray {
+		return nil, fmt.Errorf("cbor: patch: expected array, got %s", v.kind)
+	}
+	ps := make(Patch, 0, len(v.items))
+	for i, x := range v.items {
+		o, err := parseOperation(x)
+		if err != nil {
+			return nil, fmt.Errorf("cbor: patch: operation %d: %s", i, err)
+		}
+		ps = append(ps, o)
+	}
+	return ps, nil
+}
+
+func parseOperation(v Value) (Operation, error) {
+	var o Operation
+	if v.kind != KindMap {
+		return o, fmt.Errorf("expected map, got %s", v.kind)
+	}
+	op, ok := v.Get("op")
+	if !ok {
+		return o, fmt.Errorf("missing op")
+	}
+	str, err := op.Text()
+	if err != nil {
+		return o, err
+	}
+	o.Op = str
+	if o.Path, err = parsePath(v, "path"); err != nil {
+		return o, err
+	}
+	switch o.Op {
+	case "move", "copy":
+		if o.From, err = parsePath(v, "from"); err != nil {
+			return o, err
+		}
+	case "add", "replace", "test":
+		if o.Value, ok = v.Get("value"); !ok {
+			return o, fmt.Errorf("missing value")
+		}
+	case "remove":
+	default:
+		return o, fmt.Errorf("unknown op %q", o.Op)
+	}
+	return o, nil
+}
+
+func parsePath(v Value, key string) (Path, error) {
+	p, ok := v.Get(key)
+	if !ok {
+		return nil, fmt.Errorf("missing %s", key)
+	}
+	if p.kind != KindArray {
+		return nil, fmt.Errorf("%s: expected array, got %s", key, p.kind)
+	}
+	return Path(p.items), nil
+}
+
+// Bytes returns the encoding of p.
+func (p Patch) Bytes() []byte {
+	arr := NewArray()
+	for _, o := range p {
+		m := NewMap()
+		m.dict.set(NewText("op"), NewText(o.Op))
+		m.dict.set(NewText("path"), NewArray(o.Path...))
+		switch o.Op {
+		case "move", "copy":
+			m.dict.set(NewText("from"), NewArray(o.From...))
+		case "add", "replace", "test":
+			m.dict.set(NewText("value"), o.Value)
+		}
+		arr.items = append(arr.items, m)
+	}
+	return arr.append(nil)
+}
+
+// Apply applies the operations of p to the data item held by doc and returns
+// the encoding of the result. No result is returned if any operation fails.
+func (p Patch) Apply(doc []byte) ([]byte, error) {
+	v, err := decodeOne(doc)
+	if err != nil {
+		return nil, err
+	}
+	for i, o := range p {
+		if v, err = o.apply(v); err != nil {
+			return nil, fmt.Errorf("cbor: patch: operation %d: %s", i, err)
+		}
+	}
+	return v.append(nil), nil
+}
+
+// ApplyPatch applies the encoded patch held by patch to the data item held
+// by doc and returns the encoding of the result.
+func ApplyPatch(doc, patch []byte) ([]byte, error) {
+	p, err := ParsePatch(patch)
+	if err != nil {
+		return nil, err
+	}
+	return p.Apply(doc)
+}
+
+// CreatePatch returns the encoded patch that turns the data item held by a
+// into the data item held by b. It is built from the changes given by Diff.
+func CreatePatch(a, b []byte) ([]byte, error) {
+	cs, err := Diff(a, b)
+	if err != nil {
+		return nil, err
+	}
+	p := make(Patch, 0, len(cs))
+	for _, c := range cs {
+		o := Operation{Path: c.Path}
+		switch c.Kind {
+		case Added:
+			o.Op, o.Value = "add", c.New
+		case Removed:
+			o.Op = "remove"
+		default:
+			o.Op, o.Value = "replace", c.New
+		}
+		p = append(p, o)
+	}
+	return p.Bytes(), nil
+}
+
+func (o Operation) apply(doc Value) (Value, error) {
+	switch o.Op {
+	case "add":
+		return addAt(doc, o.Path, cloneValue(o.Value))
+	case "remove":
+		return removeAt(doc, o.Path)
+	case "replace":
+		return updateAt(doc, o.Path, func(Value) (Value, error) {
+			return cloneValue(o.Value), nil
+		})
+	case "move":
+		if isPrefix(o.From, o.Path) && len(o.From) < len(o.Path) {
+			return doc, fmt.Errorf("can not move %s into itself", o.From)
+		}
+		v, err := lookupAt(doc, o.From)
+		if err != nil {
+			return doc, err
+		}
+		if doc, err = removeAt(doc, o.From); err != nil {
+			return doc, err
+		}
+		return addAt(doc, o.Path, v)
+	case "copy":
+		v, err := lookupAt(doc, o.From)
+		if err != nil {
+			return doc, err
+		}
+		return addAt(doc, o.Path, cloneValue(v))
+	case "test":
+		v, err := lookupAt(doc, o.Path)
+		if err != nil {
+			return doc, err
+		}
+		if !equalValues(v, o.Value) {
+			return doc, fmt.Errorf("test failed at %s: want %s, got %s", o.Path, o.Value, v)
+		}
+		return doc, nil
+	default:
+		return doc, fmt.Errorf("unknown op %q", o.Op)
+	}
+}
+
+// MergePatch applies the patch held by patch to the data item held by doc
+// following the rules of JSON Merge Patch (RFC 7386) and returns the
+// encoding of the result. A map in patch updates the entries of the map at
+// the same place in doc, an entry with a null value removing the entry of
+// the same key. Any other item replaces the item of doc.
+func MergePatch(doc, patch []byte) ([]byte, error) {
+	v, err := decodeOne(doc)
+	if err != nil {
+		return nil, err
+	}
+	p, err := decodeOne(patch)
+	if err != nil {
+		return nil, err
+	}
+	return mergeValues(v, p).append(nil), nil
+}
+
+func mergeValues(v, p Value) Value {
+	if p.kind != KindMap {
+		return p
+	}
+	if v.kind != KindMap {
+		v = NewMap()
+	}
+	for i, k := range p.dict.keys {
+		x := p.dict.values[i]
+		if x.kind == KindNull {
+			v.dict.Delete(k)
+			continue
+		}
+		old, _ := v.dict.Get(k)
+		v.dict.set(k, mergeValues(old, x))
+	}
+	return v
+}
+
+// lookupAt returns the item of doc at path p.
+func lookupAt(doc Value, p Path) (Value, error) {
+	for i := range p {
+		v, err := childOf(doc, p[i])
+		if err != nil {
+			return doc, fmt.Errorf("%s: %s", p[:i+1], err)
+		}
+		doc = v
+	}
+	return doc, nil
+}
+
+// updateAt replaces the item of doc at path p by the result of fn.
+func updateAt(doc Value, p Path, fn func(Value) (Value, error)) (Value, error) {
+	return updatePath(doc, p, 0, fn)
+}
+
+func updatePath(doc Value, p Path, i int, fn func(Value) (Value, error)) (Value, error) {
+	if i == len(p) {
+		return fn(doc)
+	}
+	v, err := childOf(doc, p[i])
+	if err != nil {
+		return doc, fmt.Errorf("%s: %s", p[:i+1], err)
+	}
+	if v, err = updatePath(v, p, i+1, fn); err != nil {
+		return doc, err
+	}
+	if doc.kind == KindMap {
+		doc.dict.set(p[i], v)
+		return doc, nil
+	}
+	items := make([]Value, len(doc.items))
+	copy(items, doc.items)
+	items[p[i].num] = v
+	doc.items = items
+	return doc, nil
+}
+
+// addAt inserts v in doc at path p. Elements of arrays are inserted before
+// the element at the given index.
+func addAt(doc Value, p Path, v Value) (Value, error) {
+	if len(p) == 0 {
+		return v, nil
+	}
+	last := p[len(p)-1]
+	return updateAt(doc, p[:len(p)-1], func(parent Value) (Value, error) {
+		switch parent.kind {
+		case KindMap:
+			parent.dict.set(last, v)
+		case KindArray:
+			i, err := indexOf(parent, last, true)
+			if err != nil {
+				return parent, fmt.Errorf("%s: %s", p, err)
+			}
+			items := make([]Value, 0, len(parent.items)+1)
+			items = append(items, parent.items[:i]...)
+			items = append(items, v)
+			parent.items = append(items, parent.items[i:]...)
+		default:
+			return parent, fmt.Errorf("%s: can not add to %s", p, parent.kind)
+		}
+		return parent, nil
+	})
+}
+
+// removeAt removes the item of doc at path p.
+func removeAt(doc Value, p Path) (Value, error) {
+	if len(p) == 0 {
+		return doc, fmt.Errorf("can not remove root")
+	}
+	last := p[len(p)-1]
+	return updateAt(doc, p[:len(p)-1], func(parent Value) (Value, error) {
+		switch parent.kind {
+		case KindMap:
+			if !parent.dict.Delete(last) {
+				return parent, fmt.Errorf("%s: key not found", p)
+			}
+		case KindArray:
+			i, err := indexOf(parent, last, false)
+			if err != nil {
+				return parent, fmt.Errorf("%s: %s", p, err)
+			}
+			items := make([]Value, 0, len(parent.items)-1)
+			items = append(items, parent.items[:i]...)
+			parent.items = append(items, parent.items[i+1:]...)
+		default:
+			return parent, fmt.Errorf("%s: can not remove from %s", p, parent.kind)
+		}
+		return parent, nil
+	})
+}
+
+// childOf returns the entry of a map or the element of an array selected by
+// the segment k.
+func childOf(v Value, k Value) (Value, error) {
+	switch v.kind {
+	case KindMap:
+		if i, ok := v.dict.index[keyOf(k)]; ok {
+			return v.dict.values[i], nil
+		}
+		return v, fmt.Errorf("key not found")
+	case KindArray:
+		i, err := indexOf(v, k, false)
+		if err != nil {
+			return v, err
+		}
+		return v.items[i], nil
+	default:
+		return v, fmt.Errorf("can not index %s", v.kind)
+	}
+}
+
+// indexOf returns the index of an array selected by the segment k. If end is
+// set, the index can be the length of the array, also given by "-".
+func indexOf(v Value, k Value, end bool) (int, error) {
+	n := uint64(len(v.items))
+	if end {
+		if s, err := k.Text(); err == nil && s == "-" {
+			return len(v.items), nil
+		}
+		n++
+	}
+	if k.kind != KindUint {
+		return 0, fmt.Errorf("expected index, got %s", k.kind)
+	}
+	if k.num >= n {
+		return 0, ErrOutOfRange
+	}
+	return int(k.num), nil
+}
+
+func isPrefix(p, q Path) bool {
+	if len(p) > len(q) {
+		return false
+	}
+	for i := range p {
+		if keyOf(p[i]) != keyOf(q[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// cloneValue returns a copy of v that shares no map with v.
+func cloneValue(v Value) Value {
+	switch v.kind {
+	case KindArray, KindTag:
+		items := make([]Value, len(v.items))
+		for i := range v.items {
+			items[i] = cloneValue(v.items[i])
+		}
+		v.items = items
+	case KindMap:
+		m := &OrderedMap{enc: v.dict.enc}
+		for i := range v.dict.keys {
+			m.set(v.dict.keys[i], cloneValue(v.dict.values[i]))
+		}
+		v.dict = m
+	}
+	return v
+}
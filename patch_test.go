@@ -0,0 +1,147 @@
+package cbor
+
+import (
+	"testing"
+)
+
+func TestApplyPatch(t *testing.T) {
+	data := []struct {
+		Doc   string
+		Patch string
+		Want  string
+	}{
+		{
+			Doc:   `{"a": 1}`,
+			Patch: `[{"op": "add", "path": ["b"], "value": 2}]`,
+			Want:  `{"a": 1, "b": 2}`,
+		},
+		{
+			Doc:   `[1, 2]`,
+			Patch: `[{"op": "add", "path": [1], "value": 3}, {"op": "add", "path": ["-"], "value": 4}]`,
+			Want:  `[1, 3, 2, 4]`,
+		},
+		{
+			Doc:   `{1: [1, 2], h'00': true}`,
+			Patch: `[{"op": "remove", "path": [1, 0]}, {"op": "replace", "path": [h'00'], "value": false}]`,
+			Want:  `{1: [2], h'00': false}`,
+		},
+		{
+			Doc:   `{"a": {"b": 1}, "c": []}`,
+			Patch: `[{"op": "move", "from": ["a", "b"], "path": ["c", 0]}]`,
+			Want:  `{"a": {}, "c": [1]}`,
+		},
+		{
+			Doc:   `{"a": [1]}`,
+			Patch: `[{"op": "copy", "from": ["a"], "path": ["b"]}, {"op": "add", "path": ["b", "-"], "value": 2}]`,
+			Want:  `{"a": [1], "b": [1, 2]}`,
+		},
+		{
+			Doc:   `{"a": 1_1}`,
+			Patch: `[{"op": "test", "path": ["a"], "value": 1}]`,
+			Want:  `{"a": 1_1}`,
+		},
+		{
+			Doc:   `1(0)`,
+			Patch: `[{"op": "replace", "path": [], "value": 1(1)}]`,
+			Want:  `1(1)`,
+		},
+	}
+	for i, d := range data {
+		doc, patch, want := mustParse(t, d.Doc), mustParse(t, d.Patch), mustParse(t, d.Want)
+		got, err := ApplyPatch(doc, patch)
+		if err != nil {
+			t.Errorf("%d: unexpected error: %s", i+1, err)
+			continue
+		}
+		if eq, _ := Equal(got, want); !eq {
+			t.Errorf("%d: want %x, got %x", i+1, want, got)
+		}
+	}
+}
+
+func TestApplyPatchErrors(t *testing.T) {
+	data := []struct {
+		Doc   string
+		Patch string
+	}{
+		{Doc: `{"a": 1}`, Patch: `[{"op": "remove", "path": ["b"]}]`},
+		{Doc: `{"a": 1}`, Patch: `[{"op": "replace", "path": ["b"], "value": 1}]`},
+		{Doc: `{"a": 1}`, Patch: `[{"op": "add", "path": ["a", "b"], "value": 1}]`},
+		{Doc: `[1]`, Patch: `[{"op": "add", "path": [2], "value": 1}]`},
+		{Doc: `[1]`, Patch: `[{"op": "remove", "path": ["-"]}]`},
+		{Doc: `{"a": 1}`, Patch: `[{"op": "test", "path": ["a"], "value": 2}]`},
+		{Doc: `{"a": {}}`, Patch: `[{"op": "move", "from": ["a"], "path": ["a", "b"]}]`},
+		{Doc: `{"a": 1}`, Patch: `[{"op": "swap", "path": ["a"]}]`},
+		{Doc: `{"a": 1}`, Patch: `[{"op": "add", "path": ["a"]}]`},
+		{Doc: `{"a": 1}`, Patch: `{"op": "remove", "path": ["a"]}`},
+	}
+	for i, d := range data {
+		if _, err := ApplyPatch(mustParse(t, d.Doc), mustParse(t, d.Patch)); err == nil {
+			t.Errorf("%d: expected error, got none", i+1)
+		}
+	}
+}
+
+func TestCreatePatch(t *testing.T) {
+	data := []struct {
+		A, B string
+	}{
+		{A: `1`, B: `2`},
+		{A: `{"a": 1, "b": [1, 2, 3]}`, B: `{"b": [1, 4], "c": {"d": null}}`},
+		{A: `[1, [2, 3]]`, B: `[1, [2, 3, 4], 5]`},
+		{A: `{1: 0("x")}`, B: `{1: 1(0)}`},
+		{A: `{"a": 1(1363896240)}`, B: `{"a": 1(1363896241)}`},
+	}
+	for i, d := range data {
+		a, b := mustParse(t, d.A), mustParse(t, d.B)
+		patch, err := CreatePatch(a, b)
+		if err != nil {
+			t.Errorf("%d: unexpected error: %s", i+1, err)
+			continue
+		}
+		got, err := ApplyPatch(a, patch)
+		if err != nil {
+			t.Errorf("%d: fail to apply patch: %s", i+1, err)
+			continue
+		}
+		if eq, _ := Equal(got, b); !eq {
+			t.Errorf("%d: want %x, got %x", i+1, b, got)
+		}
+	}
+}
+
+func TestMergePatch(t *testing.T) {
+	data := []struct {
+		Doc   string
+		Patch string
+		Want  string
+	}{
+		{Doc: `{"a": "b"}`, Patch: `{"a": "c"}`, Want: `{"a": "c"}`},
+		{Doc: `{"a": "b"}`, Patch: `{"b": "c"}`, Want: `{"a": "b", "b": "c"}`},
+		{Doc: `{"a": "b", 1: 2}`, Patch: `{1: null}`, Want: `{"a": "b"}`},
+		{Doc: `{"a": [1]}`, Patch: `{"a": [2]}`, Want: `{"a": [2]}`},
+		{Doc: `{"a": {"b": 1}}`, Patch: `{"a": {"b": null, "c": 2}}`, Want: `{"a": {"c": 2}}`},
+		{Doc: `[1]`, Patch: `{"a": {"b": null}}`, Want: `{"a": {}}`},
+		{Doc: `{"a": 1}`, Patch: `"x"`, Want: `"x"`},
+	}
+	for i, d := range data {
+		got, err := MergePatch(mustParse(t, d.Doc), mustParse(t, d.Patch))
+		if err != nil {
+			t.Errorf("%d: unexpected error: %s", i+1, err)
+			continue
+		}
+		want := mustParse(t, d.Want)
+		if eq, _ := Equal(got, want); !eq {
+			t.Errorf("%d: want %x, got %x", i+1, want, got)
+		}
+	}
+}
+
+func mustParse(t *testing.T, str string) []byte {
+	t.Helper()
+	bs, err := ParseDiagnostic(str)
+	if err != nil {
+		t.Fatalf("fail to parse %s: %s", str, err)
+	}
+	return bs
+}
@@ -0,0 +1,806 @@
+package cbor
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"strconv"
+)
+
+// Query is a compiled expression that selects items of CBOR documents.
+//
+// Expressions start with a dot that selects the whole document and are
+// followed by selectors, each one applied to the items selected by the
+// previous ones:
+//
+//	.name        value of the entry with the text key "name"
+//	.["a b"]     value of the entry whose key is written in diagnostic notation
+//	.[1]         element at index 1 of an array or value of the entry with key 1
+//	.[-1]        last element of an array
+//	.[1:3]       elements 1 and 2 of an array, bounds can be omitted or negative
+//	.*  .[*]     all values of a map or elements of an array
+//	..name       the selector applied to the item and all its descendants
+//	.tag(1)      content of the item if it is a tag with the number 1
+//	.[?(cond)]   values of a map or elements of an array matching cond
+//
+// Conditions compare operands with ==, !=, <, <=, > and >= and are combined
+// with &&, || and !. Operands are relative paths like .type, tag(.) for the
+// tag number of the selected item, and literals in diagnostic notation. A
+// path alone is true if it selects an item that is neither false nor null.
+// Numbers are compared by value and strings bytewise; other items are only
+// equal or not.
+type Query struct {
+	expr  string
+	steps []step
+}
+
+// CompileQuery parses expr and returns the Query it describes.
+func CompileQuery(expr string) (*Query, error) {
+	p := queryParser{ednParser: ednParser{str: expr}}
+	steps, err := p.path()
+	if err != nil {
+		return nil, err
+	}
+	if p.skip(); !p.done() {
+		return nil, p.errorf("unexpected character %q", p.peek())
+	}
+	return &Query{expr: expr, steps: steps}, nil
+}
+
+// Select compiles expr and applies it to data.
+func Select(data []byte, expr string) ([]RawMessage, error) {
+	q, err := CompileQuery(expr)
+	if err != nil {
+		return nil, err
+	}
+	return q.Select(data)
+}
+
+func (q *Query) String() string {
+	return q.expr
+}
+
+// Select applies q to each data item held by data and returns the items
+// selected in document order. They are sub slices of data.
+func (q *Query) Select(data []byte) ([]RawMessage, error) {
+	var (
+		s   = scanBytes(data)
+		res []RawMessage
+	)
+	for s.more() {
+		start := s.off
+		if err := skipItem(s); err != nil {
+			return nil, s.truncated(shiftError(err, start))
+		}
+		rs, err := q.eval(data[start:s.off])
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, rs...)
+	}
+	return res, nil
+}
+
+// SelectReader applies q to each data item read from r. Only one item of
+// the input is kept in memory at a time.
+func (q *Query) SelectReader(r io.Reader) ([]RawMessage, error) {
+	var (
+		s   = newScanner(r)
+		res []RawMessage
+	)
+	for s.more() {
+		start := s.off
+		item, err := readRaw(s)
+		if err != nil {
+			return nil, s.truncated(shiftError(err, start))
+		}
+		rs, err := q.eval(item)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, rs...)
+	}
+	return res, nil
+}
+
+func (q *Query) eval(item []byte) ([]RawMessage, error) {
+	return evalSteps(q.steps, item)
+}
+
+func evalSteps(steps []step, item []byte) ([]RawMessage, error) {
+	items := []RawMessage{item}
+	for _, s := range steps {
+		var (
+			next []RawMessage
+			err  error
+		)
+		for _, it := range items {
+			if next, err = s.apply(it, next); err != nil {
+				return nil, err
+			}
+		}
+		items = next
+	}
+	return items, nil
+}
+
+// step is a selector of a Query. It appends to out the items it selects in
+// item.
+type step interface {
+	apply(item []byte, out []RawMessage) ([]RawMessage, error)
+}
+
+type keyStep struct {
+	key segment
+}
+
+func (k keyStep) apply(item []byte, out []RawMessage) ([]RawMessage, error) {
+	h, _, err := headerAt(item, 0)
+	if err != nil {
+		return nil, err
+	}
+	if h.Major == Array && (k.key.major == Uint || k.key.major == Int) {
+		els, err := elements(item)
+		if err != nil {
+			return nil, err
+		}
+		i, ok := absIndex(k.key, len(els))
+		if ok {
+			out = append(out, els[i])
+		}
+		return out, nil
+	}
+	if h.Major != Map {
+		return out, nil
+	}
+	err = eachChild(item, func(key, val []byte) bool {
+		if k.key.match(key) {
+			out = append(out, val)
+			return false
+		}
+		return true
+	})
+	return out, err
+}
+
+func absIndex(k segment, n int) (int, bool) {
+	if k.major == Int {
+		if k.arg >= uint64(n) {
+			return 0, false
+		}
+		return n - 1 - int(k.arg), true
+	}
+	if k.arg >= uint64(n) {
+		return 0, false
+	}
+	return int(k.arg), true
+}
+
+type wildcardStep struct{}
+
+func (wildcardStep) apply(item []byte, out []RawMessage) ([]RawMessage, error) {
+	h, _, err := headerAt(item, 0)
+	if err != nil || (h.Major != Array && h.Major != Map) {
+		return out, err
+	}
+	err = eachChild(item, func(_, val []byte) bool {
+		out = append(out, val)
+		return true
+	})
+	return out, err
+}
+
+type sliceStep struct {
+	start, end       int
+	hasStart, hasEnd bool
+}
+
+func (s sliceStep) apply(item []byte, out []RawMessage) ([]RawMessage, error) {
+	h, _, err := headerAt(item, 0)
+	if err != nil || h.Major != Array {
+		return out, err
+	}
+	els, err := elements(item)
+	if err != nil {
+		return nil, err
+	}
+	n := len(els)
+	start, end := 0, n
+	if s.hasStart {
+		start = bound(s.start, n)
+	}
+	if s.hasEnd {
+		end = bound(s.end, n)
+	}
+	for i := start; i < end; i++ {
+		out = append(out, els[i])
+	}
+	return out, nil
+}
+
+func bound(i, n int) int {
+	if i < 0 {
+		i += n
+	}
+	switch {
+	case i < 0:
+		return 0
+	case i > n:
+		return n
+	default:
+		return i
+	}
+}
+
+type tagStep struct {
+	num uint64
+}
+
+func (t tagStep) apply(item []byte, out []RawMessage) ([]RawMessage, error) {
+	h, next, err := headerAt(item, 0)
+	if err != nil {
+		return nil, err
+	}
+	if h.Major == Tag && h.Arg == t.num {
+		out = append(out, item[next:])
+	}
+	return out, nil
+}
+
+type filterStep struct {
+	cond condition
+}
+
+func (f filterStep) apply(item []byte, out []RawMessage) ([]RawMessage, error) {
+	h, _, err := headerAt(item, 0)
+	if err != nil || (h.Major != Array && h.Major != Map) {
+		return out, err
+	}
+	var errf error
+	err = eachChild(item, func(_, val []byte) bool {
+		ok, err := f.cond.match(val)
+		if err != nil {
+			errf = err
+			return false
+		}
+		if ok {
+			out = append(out, val)
+		}
+		return true
+	})
+	if err == nil {
+		err = errf
+	}
+	return out, err
+}
+
+// recursiveStep applies its step to an item and to all its descendants.
+type recursiveStep struct {
+	step
+}
+
+func (r recursiveStep) apply(item []byte, out []RawMessage) ([]RawMessage, error) {
+	out, err := r.step.apply(item, out)
+	if err != nil {
+		return nil, err
+	}
+	var errf error
+	err = eachChild(item, func(_, val []byte) bool {
+		out, errf = r.apply(val, out)
+		return errf == nil
+	})
+	if err == nil {
+		err = errf
+	}
+	return out, err
+}
+
+// eachChild calls fn with the key and the value of each entry of a map, the
+// elements of an array or the content of a tag until fn returns false. The
+// key is nil for arrays and tags.
+func eachChild(item []byte, fn func(key, val []byte) bool) error {
+	s := scanBytes(item)
+	h, err := s.header()
+	if err != nil {
+		return err
+	}
+	switch h.Major {
+	case Tag:
+		fn(nil, item[s.off:])
+		return nil
+	case Array, Map:
+	default:
+		return nil
+	}
+	for i := uint64(0); ; i++ {
+		if h.Indefinite() {
+			brk, err := s.peekBreak()
+			if err != nil {
+				return err
+			}
+			if brk {
+				return nil
+			}
+		} else if i >= h.Arg {
+			return nil
+		}
+		var key []byte
+		if h.Major == Map {
+			start := s.off
+			if err := skipItem(s); err != nil {
+				return s.truncated(shiftError(err, start))
+			}
+			key = item[start:s.off]
+		}
+		start := s.off
+		if err := skipItem(s); err != nil {
+			return s.truncated(shiftError(err, start))
+		}
+		if !fn(key, item[start:s.off]) {
+			return nil
+		}
+	}
+}
+
+func elements(item []byte) ([]RawMessage, error) {
+	var els []RawMessage
+	err := eachChild(item, func(_, val []byte) bool {
+		els = append(els, val)
+		return true
+	})
+	return els, err
+}
+
+// scanBytes returns a scanner reading bs with a small buffer since all the
+// bytes are already in memory.
+func scanBytes(bs []byte) *scanner {
+	return &scanner{r: bufio.NewReaderSize(bytes.NewReader(bs), 16)}
+}
+
+// condition is the condition of a filter.
+type condition interface {
+	match(item []byte) (bool, error)
+}
+
+type orCond struct {
+	left, right condition
+}
+
+func (c orCond) match(item []byte) (bool, error) {
+	ok, err := c.left.match(item)
+	if err != nil || ok {
+		return ok, err
+	}
+	return c.right.match(item)
+}
+
+type andCond struct {
+	left, right condition
+}
+
+func (c andCond) match(item []byte) (bool, error) {
+	ok, err := c.left.match(item)
+	if err != nil || !ok {
+		return ok, err
+	}
+	return c.right.match(item)
+}
+
+type notCond struct {
+	cond condition
+}
+
+func (c notCond) match(item []byte) (bool, error) {
+	ok, err := c.cond.match(item)
+	return !ok, err
+}
+
+type compareCond struct {
+	left, right operand
+	op          string
+}
+
+func (c compareCond) match(item []byte) (bool, error) {
+	x, ok, err := c.left.value(item)
+	if err != nil {
+		return false, err
+	}
+	if c.right == nil {
+		return ok && x.kind != KindNull && !(x.kind == KindBool && x.num == 0), nil
+	}
+	y, ok2, err := c.right.value(item)
+	if err != nil {
+		return false, err
+	}
+	if !ok || !ok2 {
+		return c.op == "!=" && ok != ok2, nil
+	}
+	switch c.op {
+	case "==":
+		return equalValues(x, y), nil
+	case "!=":
+		return !equalValues(x, y), nil
+	}
+	cmp, ok := compareValues(x, y)
+	if !ok {
+		return false, nil
+	}
+	switch c.op {
+	case "<":
+		return cmp < 0, nil
+	case "<=":
+		return cmp <= 0, nil
+	case ">":
+		return cmp > 0, nil
+	default:
+		return cmp >= 0, nil
+	}
+}
+
+// compareValues orders numbers by value and strings of the same type
+// bytewise. It returns false if x and y can not be ordered.
+func compareValues(x, y Value) (int, bool) {
+	isInt := func(v Value) bool { return v.kind == KindUint || v.kind == KindInt }
+	switch {
+	case isInt(x) && isInt(y):
+		if x.kind != y.kind {
+			if x.kind == KindInt {
+				return -1, true
+			}
+			return 1, true
+		}
+		c := compareUint(x.num, y.num)
+		if x.kind == KindInt {
+			c = -c
+		}
+		return c, true
+	case (isInt(x) || x.kind == KindFloat) && (isInt(y) || y.kind == KindFloat):
+		f, g := toFloat(x), toFloat(y)
+		switch {
+		case f < g:
+			return -1, true
+		case f > g:
+			return 1, true
+		case f == g:
+			return 0, true
+		}
+		return 0, false
+	case x.kind == y.kind && (x.kind == KindText || x.kind == KindBytes):
+		return bytes.Compare(x.bytes, y.bytes), true
+	default:
+		return 0, false
+	}
+}
+
+func compareUint(a, b uint64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	default:
+		return 0
+	}
+}
+
+func toFloat(v Value) float64 {
+	switch v.kind {
+	case KindUint:
+		return float64(v.num)
+	case KindInt:
+		return -1 - float64(v.num)
+	default:
+		return v.float
+	}
+}
+
+// operand is a side of a comparison. It returns false if it selects no item.
+type operand interface {
+	value(item []byte) (Value, bool, error)
+}
+
+type pathOperand struct {
+	steps []step
+}
+
+func (p pathOperand) value(item []byte) (Value, bool, error) {
+	rs, err := evalSteps(p.steps, item)
+	if err != nil || len(rs) == 0 {
+		return Value{}, false, err
+	}
+	v, err := decodeOne(rs[0])
+	return v, err == nil, err
+}
+
+type tagOperand struct {
+	steps []step
+}
+
+func (t tagOperand) value(item []byte) (Value, bool, error) {
+	rs, err := evalSteps(t.steps, item)
+	if err != nil || len(rs) == 0 {
+		return Value{}, false, err
+	}
+	h, _, err := headerAt(rs[0], 0)
+	if err != nil || h.Major != Tag {
+		return Value{}, false, err
+	}
+	return NewUint(h.Arg), true, nil
+}
+
+type literalOperand struct {
+	val Value
+}
+
+func (l literalOperand) value([]byte) (Value, bool, error) {
+	return l.val, true, nil
+}
+
+type queryParser struct {
+	ednParser
+}
+
+// path parses a dot followed by selectors.
+func (p *queryParser) path() ([]step, error) {
+	if !p.accept(".") {
+		return nil, p.errorf("expected '.'")
+	}
+	var steps []step
+	if !p.selectorStart() && p.peek() != '.' {
+		return steps, nil
+	}
+	for {
+		rec := p.accept(".")
+		s, err := p.selector()
+		if err != nil {
+			return nil, err
+		}
+		if rec {
+			s = recursiveStep{s}
+		}
+		steps = append(steps, s)
+		for p.peek() == '[' {
+			if s, err = p.bracket(); err != nil {
+				return nil, err
+			}
+			steps = append(steps, s)
+		}
+		if p.peek() != '.' {
+			return steps, nil
+		}
+		p.pos++
+	}
+}
+
+func (p *queryParser) selectorStart() bool {
+	c := p.peek()
+	return c == '*' || c == '[' || c == '_' || isLetter(c)
+}
+
+func (p *queryParser) selector() (step, error) {
+	switch c := p.peek(); {
+	case c == '*':
+		p.pos++
+		return wildcardStep{}, nil
+	case c == '[':
+		return p.bracket()
+	case c == '_' || isLetter(c):
+	default:
+		return nil, p.errorf("expected selector")
+	}
+	start := p.pos
+	for !p.done() {
+		if c := p.peek(); c != '_' && c != '-' && !isLetter(c) && !isDigit(c) {
+			break
+		}
+		p.pos++
+	}
+	ident := p.str[start:p.pos]
+	if ident == "tag" && p.accept("(") {
+		p.skip()
+		n, err := p.integer()
+		if err != nil {
+			return nil, err
+		}
+		if n < 0 {
+			return nil, p.errorf("invalid tag number %d", n)
+		}
+		if p.skip(); !p.accept(")") {
+			return nil, p.errorf("expected ')'")
+		}
+		return tagStep{num: uint64(n)}, nil
+	}
+	return keyStep{key: segmentOf(NewText(ident))}, nil
+}
+
+// bracket parses a selector enclosed in brackets.
+func (p *queryParser) bracket() (step, error) {
+	p.pos++
+	if err := p.skip(); err != nil {
+		return nil, err
+	}
+	var (
+		s   step
+		err error
+	)
+	switch {
+	case p.accept("*"):
+		s = wildcardStep{}
+	case p.accept("?"):
+		if p.skip(); !p.accept("(") {
+			return nil, p.errorf("expected '('")
+		}
+		var c condition
+		if c, err = p.condition(); err != nil {
+			return nil, err
+		}
+		if p.skip(); !p.accept(")") {
+			return nil, p.errorf("expected ')'")
+		}
+		s = filterStep{cond: c}
+	default:
+		s, err = p.keyOrSlice()
+	}
+	if err != nil {
+		return nil, err
+	}
+	if p.skip(); !p.accept("]") {
+		return nil, p.errorf("expected ']'")
+	}
+	return s, nil
+}
+
+func (p *queryParser) keyOrSlice() (step, error) {
+	var (
+		pos = p.pos
+		s   sliceStep
+		err error
+	)
+	if c := p.peek(); c == '-' || isDigit(c) {
+		if s.start, err = p.integer(); err == nil {
+			s.hasStart = true
+		}
+		p.skip()
+	}
+	if err == nil && p.accept(":") {
+		p.skip()
+		if c := p.peek(); c == '-' || isDigit(c) {
+			if s.end, err = p.integer(); err != nil {
+				return nil, err
+			}
+			s.hasEnd = true
+		}
+		return s, nil
+	}
+	p.pos = pos
+	v, err := p.literal()
+	if err != nil {
+		return nil, err
+	}
+	return keyStep{key: segmentOf(v)}, nil
+}
+
+func (p *queryParser) integer() (int, error) {
+	start := p.pos
+	p.accept("-")
+	p.span("0123456789")
+	n, err := strconv.Atoi(p.str[start:p.pos])
+	if err != nil {
+		return 0, p.errorf("invalid integer %q", p.str[start:p.pos])
+	}
+	return n, nil
+}
+
+// literal parses an item in diagnostic notation.
+func (p *queryParser) literal() (Value, error) {
+	bs, err := p.item(nil)
+	if err != nil {
+		return Value{}, err
+	}
+	return decodeOne(bs)
+}
+
+func (p *queryParser) condition() (condition, error) {
+	left, err := p.conjunction()
+	if err != nil {
+		return nil, err
+	}
+	for p.skip(); p.accept("||"); p.skip() {
+		right, err := p.conjunction()
+		if err != nil {
+			return nil, err
+		}
+		left = orCond{left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *queryParser) conjunction() (condition, error) {
+	left, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	for p.skip(); p.accept("&&"); p.skip() {
+		right, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		left = andCond{left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *queryParser) unary() (condition, error) {
+	p.skip()
+	if p.accept("!") {
+		c, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return notCond{cond: c}, nil
+	}
+	if p.accept("(") {
+		c, err := p.condition()
+		if err != nil {
+			return nil, err
+		}
+		if p.skip(); !p.accept(")") {
+			return nil, p.errorf("expected ')'")
+		}
+		return c, nil
+	}
+	return p.comparison()
+}
+
+func (p *queryParser) comparison() (condition, error) {
+	left, err := p.operand()
+	if err != nil {
+		return nil, err
+	}
+	c := compareCond{left: left}
+	p.skip()
+	for _, op := range []string{"==", "!=", "<=", ">=", "<", ">"} {
+		if p.accept(op) {
+			c.op = op
+			break
+		}
+	}
+	if c.op == "" {
+		if _, ok := left.(literalOperand); ok {
+			return nil, p.errorf("expected comparison operator")
+		}
+		return c, nil
+	}
+	p.skip()
+	if c.right, err = p.operand(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (p *queryParser) operand() (operand, error) {
+	switch {
+	case p.peek() == '.':
+		steps, err := p.path()
+		if err != nil {
+			return nil, err
+		}
+		return pathOperand{steps: steps}, nil
+	case p.accept("tag("):
+		p.skip()
+		steps, err := p.path()
+		if err != nil {
+			return nil, err
+		}
+		if p.skip(); !p.accept(")") {
+			return nil, p.errorf("expected ')'")
+		}
+		return tagOperand{steps: steps}, nil
+	default:
+		v, err := p.literal()
+		if err != nil {
+			return nil, err
+		}
+		return literalOperand{val: v}, nil
+	}
+}
@@ -0,0 +1,105 @@
+package cbor
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+)
+
+func TestQuery(t *testing.T) {
+	doc := `{
+		"name": "doc",
+		"items": [
+			{"id": 1, "type": 3, "at": 1(1363896240)},
+			{"id": 2, "type": 1, "sub": {"id": 4}},
+			{"id": 3, "type": 3, "at": 0("2013-03-21T20:04:00Z")}
+		],
+		"more": [_ 10, 20, 30, 40],
+		1: "one",
+		h'00': {"id": 5}
+	}`
+	data := []struct {
+		Query string
+		Want  []string
+	}{
+		{Query: `.`, Want: []string{doc}},
+		{Query: `.name`, Want: []string{`"doc"`}},
+		{Query: `.["name"]`, Want: []string{`"doc"`}},
+		{Query: `.[1]`, Want: []string{`"one"`}},
+		{Query: `.[h'00'].id`, Want: []string{`5`}},
+		{Query: `.items[1].id`, Want: []string{`2`}},
+		{Query: `.items[-1].id`, Want: []string{`3`}},
+		{Query: `.items[5]`},
+		{Query: `.missing.id`},
+		{Query: `.items[*].id`, Want: []string{`1`, `2`, `3`}},
+		{Query: `.items.*.type`, Want: []string{`3`, `1`, `3`}},
+		{Query: `.more[1:3]`, Want: []string{`20`, `30`}},
+		{Query: `.more[:-3]`, Want: []string{`10`}},
+		{Query: `.more[2:]`, Want: []string{`30`, `40`}},
+		{Query: `..id`, Want: []string{`1`, `2`, `4`, `3`, `5`}},
+		{Query: `.items..id`, Want: []string{`1`, `2`, `4`, `3`}},
+		{Query: `.items[?(.type == 3)].id`, Want: []string{`1`, `3`}},
+		{Query: `.items[?(.type != 3)].id`, Want: []string{`2`}},
+		{Query: `.items[?(.id >= 2 && .type < 3)].id`, Want: []string{`2`}},
+		{Query: `.items[?(.id == 1 || .sub)].id`, Want: []string{`1`, `2`}},
+		{Query: `.items[?(!.at)].id`, Want: []string{`2`}},
+		{Query: `.more[?(. > 15 && . < 35.5)]`, Want: []string{`20`, `30`}},
+		{Query: `.items[?(tag(.at) == 1)].id`, Want: []string{`1`}},
+		{Query: `.items[*].at.tag(0)`, Want: []string{`"2013-03-21T20:04:00Z"`}},
+		{Query: `..tag(1)`, Want: []string{`1363896240`}},
+		{Query: `.[?(. == "doc")]`, Want: []string{`"doc"`}},
+	}
+	bs := mustParse(t, doc)
+	for i, d := range data {
+		got, err := Select(bs, d.Query)
+		if err != nil {
+			t.Errorf("%d: %s: unexpected error: %s", i+1, d.Query, err)
+			continue
+		}
+		if len(got) != len(d.Want) {
+			t.Errorf("%d: %s: want %d items, got %d", i+1, d.Query, len(d.Want), len(got))
+			continue
+		}
+		for j := range got {
+			want := mustParse(t, d.Want[j])
+			if !bytes.Equal(got[j], want) {
+				t.Errorf("%d: %s: item %d: want %x, got %x", i+1, d.Query, j+1, want, got[j])
+			}
+		}
+	}
+}
+
+func TestQueryReader(t *testing.T) {
+	q, err := CompileQuery(`.[?(.ok)].id`)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	bs := mustParse(t, `[{"id": 1, "ok": true}] [{"id": 2, "ok": false}, {"id": 3, "ok": 1}]`)
+	got, err := q.SelectReader(bytes.NewReader(bs))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(got) != 2 || hex.EncodeToString(got[0]) != "01" || hex.EncodeToString(got[1]) != "03" {
+		t.Errorf("unexpected result: %x", got)
+	}
+}
+
+func TestCompileQueryInvalid(t *testing.T) {
+	data := []string{
+		``,
+		`name`,
+		`.[`,
+		`.[1`,
+		`.[?(.a == )]`,
+		`.[?(.a == 1]`,
+		`.[?(1)]`,
+		`.tag(-1)`,
+		`.a b`,
+		`.a.`,
+	}
+	for _, d := range data {
+		if _, err := CompileQuery(d); err == nil {
+			t.Errorf("%s: expected error, got none", d)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package cbor
+
+import (
+	"io"
+)
+
+// sliceReader reads from a byte slice. It gives access to the bytes read so
+// that they can be used without being copied.
+type sliceReader struct {
+	buf []byte
+	pos int
+}
+
+func (r *sliceReader) ReadByte() (byte, error) {
+	if r.pos >= len(r.buf) {
+		return 0, io.EOF
+	}
+	b := r.buf[r.pos]
+	r.pos++
+	return b, nil
+}
+
+// header is ReadHeader for a sliceReader. Being called on the concrete type,
+// it does not make r escape.
+func (r *sliceReader) header() (Header, error) {
+	b, err := r.ReadByte()
+	if err != nil {
+		return Header{}, err
+	}
+	h, err := headerOf(b)
+	if err != nil {
+		return h, err
+	}
+	z := h.size()
+	if len(r.buf)-r.pos < z {
+		r.pos = len(r.buf)
+		return h, io.ErrUnexpectedEOF
+	}
+	for _, b := range r.buf[r.pos : r.pos+z] {
+		h.Arg = h.Arg<<8 | uint64(b)
+	}
+	r.pos += z
+	return h, nil
+}
+
+func (r *sliceReader) UnreadByte() error {
+	if r.pos == 0 {
+		return io.ErrNoProgress
+	}
+	r.pos--
+	return nil
+}
+
+func (r *sliceReader) Read(bs []byte) (int, error) {
+	if r.pos >= len(r.buf) {
+		return 0, io.EOF
+	}
+	n := copy(bs, r.buf[r.pos:])
+	r.pos += n
+	return n, nil
+}
+
+func (r *sliceReader) Discard(n int) (int, error) {
+	if z := len(r.buf) - r.pos; n > z {
+		r.pos = len(r.buf)
+		return z, io.EOF
+	}
+	r.pos += n
+	return n, nil
+}
+
+// next returns the next n bytes of the input.
+func (r *sliceReader) next(n uint64) ([]byte, error) {
+	if n > uint64(len(r.buf)-r.pos) {
+		r.pos = len(r.buf)
+		return nil, io.ErrUnexpectedEOF
+	}
+	bs := r.buf[r.pos : r.pos+int(n)]
+	r.pos += int(n)
+	return bs, nil
+}
+
+// countReader counts the bytes read from a stream so that errors can give
+// their offset.
+type countReader struct {
+	r reader
+	n int64
+}
+
+func (r *countReader) ReadByte() (byte, error) {
+	b, err := r.r.ReadByte()
+	if err == nil {
+		r.n++
+	}
+	return b, err
+}
+
+func (r *countReader) UnreadByte() error {
+	err := r.r.(io.ByteScanner).UnreadByte()
+	if err == nil {
+		r.n--
+	}
+	return err
+}
+
+func (r *countReader) Read(bs []byte) (int, error) {
+	n, err := r.r.Read(bs)
+	r.n += int64(n)
+	return n, err
+}
+
+func (r *countReader) Discard(n int) (int, error) {
+	if d, ok := r.r.(interface{ Discard(int) (int, error) }); ok {
+		c, err := d.Discard(n)
+		r.n += int64(c)
+		return c, err
+	}
+	c, err := io.CopyN(io.Discard, r.r, int64(n))
+	r.n += c
+	return int(c), err
+}
@@ -0,0 +1,108 @@
+package cbor
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+)
+
+// header is the header of a data item and the offset of its first byte.
+type header struct {
+	Header
+	offset int64
+}
+
+// scanner reads the headers and payloads of data items from a single buffered
+// reader and keeps track of the current offset in the input.
+type scanner struct {
+	r   *bufio.Reader
+	off int64
+}
+
+func newScanner(r io.Reader) *scanner {
+	return &scanner{r: bufio.NewReader(r)}
+}
+
+// more reports whether there are bytes left to read.
+func (s *scanner) more() bool {
+	_, err := s.r.Peek(1)
+	return err == nil
+}
+
+// header reads the initial byte and the argument of the next data item. A
+// break code is returned as a header with a major type Other and an
+// indefinite length.
+func (s *scanner) header() (header, error) {
+	h := header{offset: s.off}
+	var err error
+	if h.Header, err = ReadHeader(s); err != nil {
+		return h, s.truncated(shiftError(err, h.offset))
+	}
+	return h, nil
+}
+
+// peekBreak consumes the next byte if it is a break code.
+func (s *scanner) peekBreak() (bool, error) {
+	b, err := s.r.Peek(1)
+	if err != nil {
+		return false, s.truncated(err)
+	}
+	if b[0] != Break {
+		return false, nil
+	}
+	s.r.ReadByte()
+	s.off++
+	return true, nil
+}
+
+// chunk reads the header of the next chunk of an indefinite length string of
+// major type m. It returns false when the break code is reached.
+func (s *scanner) chunk(m byte) (header, bool, error) {
+	h, err := s.header()
+	if err != nil {
+		return h, false, err
+	}
+	if h.IsBreak() {
+		return h, false, nil
+	}
+	if h.Major != m || h.Indefinite() {
+		return h, false, s.errorf(h.offset, "invalid chunk in indefinite length string")
+	}
+	return h, true, nil
+}
+
+func (s *scanner) ReadByte() (byte, error) {
+	b, err := s.r.ReadByte()
+	if err == nil {
+		s.off++
+	}
+	return b, err
+}
+
+func (s *scanner) Read(bs []byte) (int, error) {
+	n, err := s.r.Read(bs)
+	s.off += int64(n)
+	return n, err
+}
+
+func (s *scanner) Discard(n int) (int, error) {
+	n, err := s.r.Discard(n)
+	s.off += int64(n)
+	return n, err
+}
+
+func (s *scanner) readFull(bs []byte) error {
+	_, err := io.ReadFull(s, bs)
+	return s.truncated(err)
+}
+
+func (s *scanner) truncated(err error) error {
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return s.errorf(s.off, "unexpected end of input")
+	}
+	return err
+}
+
+func (s *scanner) errorf(off int64, pattern string, args ...interface{}) error {
+	return &SyntaxError{msg: fmt.Sprintf(pattern, args...), Offset: off}
+}
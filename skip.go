@@ -0,0 +1,190 @@
+package cbor
+
+import (
+	"io"
+	"math"
+)
+
+// Skip reads and discards the next data item of r, including nested and
+// indefinite length items, and returns the number of bytes it was made of.
+// It returns io.EOF if r is at its end. The offsets of its syntax errors are
+// relative to the first byte of the item.
+//
+// Payloads are discarded without being kept in memory and nested items are
+// not skipped recursively: the memory used does not depend on the size of
+// the item nor on the nesting of definite length containers. If r is not an
+// io.ByteReader, it is read one byte at a time for headers so that no byte
+// following the item is consumed.
+func Skip(r io.Reader) (int64, error) {
+	rs, ok := r.(reader)
+	if !ok {
+		rs = &byteReader{Reader: r}
+	}
+	return skip(rs, 1, nil)
+}
+
+// Skip discards the next data item of the input and returns the number of
+// bytes it was made of. It can be mixed with calls to Token.
+func (d *Decoder) Skip() (int64, error) {
+	d.complete()
+	if err := d.discard(); err != nil {
+		return 0, err
+	}
+	d.enter()
+	off := d.offset()
+	n, err := skip(d.r, 1, nil)
+	return n, shiftError(err, off)
+}
+
+// skipItem reads and discards one complete data item from r.
+func skipItem(r reader) error {
+	_, err := skip(r, 1, nil)
+	return err
+}
+
+// skipIndefinite reads and discards the elements or the chunks of an
+// indefinite length item of major type m whose header was already read, up
+// to and including the break code.
+func skipIndefinite(r reader, m byte) error {
+	_, err := skip(r, 0, []skipFrame{{major: m}})
+	return err
+}
+
+// skipFrame is an indefinite length item being skipped.
+type skipFrame struct {
+	major byte
+	// left is the number of items left in the enclosing definite length
+	// containers when the item started.
+	left uint64
+	// count is the number of items read in the item.
+	count uint64
+}
+
+// skip discards left items and the rest of the indefinite length items of
+// stack. The number of items of definite length containers are added to
+// left, so that only indefinite length items need a frame. The offsets of its
+// syntax errors are relative to the first byte read.
+func skip(r reader, left uint64, stack []skipFrame) (int64, error) {
+	var (
+		n     int64
+		base  [8]skipFrame
+		start = len(stack)
+	)
+	if start == 0 {
+		stack = base[:0]
+	}
+	for left > 0 || len(stack) > 0 {
+		off := n
+		h, err := ReadHeader(r)
+		if err != nil {
+			if err == io.EOF && (n > 0 || start > 0) {
+				err = io.ErrUnexpectedEOF
+			}
+			return n, shiftError(err, off)
+		}
+		n += 1 + int64(h.size())
+
+		var top *skipFrame
+		if left == 0 {
+			top = &stack[len(stack)-1]
+		}
+		m, arg := h.Major, h.Arg
+		if h.IsBreak() {
+			if top == nil {
+				return n, &SyntaxError{msg: "unexpected break", Offset: off}
+			}
+			if top.major == Map && top.count%2 == 1 {
+				return n, &SyntaxError{msg: "missing value in indefinite length map", Offset: off}
+			}
+			left, stack = top.left, stack[:len(stack)-1]
+			continue
+		}
+		if top == nil {
+			left--
+		} else {
+			top.count++
+			if (top.major == Bin || top.major == String) && (m != top.major || h.Indefinite()) {
+				return n, &SyntaxError{msg: "invalid chunk in indefinite length string", Offset: off}
+			}
+		}
+		if h.Indefinite() {
+			stack = append(stack, skipFrame{major: m, left: left})
+			left = 0
+			continue
+		}
+		switch m {
+		case Bin, String:
+			if arg > math.MaxInt64 {
+				return n, ErrTooLarge
+			}
+			if err := discard(r, arg); err != nil {
+				return n, err
+			}
+			n += int64(arg)
+		case Array, Map:
+			if m == Map {
+				if arg > math.MaxUint64/2 {
+					return n, ErrTooLarge
+				}
+				arg *= 2
+			}
+			if arg > math.MaxUint64-left {
+				return n, ErrTooLarge
+			}
+			left += arg
+		case Tag:
+			left++
+		}
+	}
+	return n, nil
+}
+
+// discard reads and discards n bytes from r.
+func discard(r reader, n uint64) error {
+	if d, ok := r.(interface{ Discard(int) (int, error) }); ok {
+		for n > 0 {
+			z := n
+			if z > math.MaxInt32 {
+				z = math.MaxInt32
+			}
+			c, err := d.Discard(int(z))
+			n -= uint64(c)
+			if err != nil {
+				return unexpected(err)
+			}
+		}
+		return nil
+	}
+	var buf [512]byte
+	for n > 0 {
+		z := uint64(len(buf))
+		if z > n {
+			z = n
+		}
+		c, err := io.ReadFull(r, buf[:z])
+		n -= uint64(c)
+		if err != nil {
+			return unexpected(err)
+		}
+	}
+	return nil
+}
+
+func unexpected(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// byteReader reads one byte at a time from a reader that is not an
+// io.ByteReader.
+type byteReader struct {
+	io.Reader
+	buf [1]byte
+}
+
+func (r *byteReader) ReadByte() (byte, error) {
+	_, err := io.ReadFull(r.Reader, r.buf[:])
+	return r.buf[0], err
+}
@@ -0,0 +1,161 @@
+package cbor
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"io"
+	"testing"
+	"testing/iotest"
+)
+
+func TestSkip(t *testing.T) {
+	data := []string{
+		"00",
+		"1bffffffffffffffff",
+		"3903e7",
+		"4401020304",
+		"5f42010243030405ff",
+		"7f657374726561646d696e67ff",
+		"80",
+		"83010203",
+		"8301820203820405",
+		"9f018202039f0405ffff",
+		"a26161016162820203",
+		"bf61610161629f0203ffff",
+		"bf9f9f9f9f9f9f9f9f9f01ffffffffffffffffff02ff",
+		"c11a514b67b0",
+		"d818456449455446",
+		"f93c00",
+		"fb3ff199999999999a",
+		"f8ff",
+	}
+	readers := []struct {
+		Name string
+		New  func([]byte) io.Reader
+	}{
+		{Name: "bytes", New: func(bs []byte) io.Reader { return bytes.NewReader(bs) }},
+		{Name: "bufio", New: func(bs []byte) io.Reader { return bufio.NewReader(bytes.NewReader(bs)) }},
+		{Name: "reader", New: func(bs []byte) io.Reader { return iotest.OneByteReader(bytes.NewReader(bs)) }},
+	}
+	for _, rs := range readers {
+		for i, d := range data {
+			bs, _ := hex.DecodeString(d + "01")
+			r := rs.New(bs)
+			n, err := Skip(r)
+			if err != nil {
+				t.Errorf("%s %d: unexpected error: %s", rs.Name, i+1, err)
+				continue
+			}
+			if n != int64(len(bs)-1) {
+				t.Errorf("%s %d: want %d bytes skipped, got %d", rs.Name, i+1, len(bs)-1, n)
+			}
+			rest, _ := io.ReadAll(r)
+			if hex.EncodeToString(rest) != "01" {
+				t.Errorf("%s %d: unexpected bytes left: %x", rs.Name, i+1, rest)
+			}
+		}
+	}
+}
+
+func TestSkipErrors(t *testing.T) {
+	data := []struct {
+		Raw    string
+		Err    error
+		Offset int64
+	}{
+		{Raw: "", Err: io.EOF},
+		{Raw: "19", Err: io.ErrUnexpectedEOF},
+		{Raw: "4401", Err: io.ErrUnexpectedEOF},
+		{Raw: "8301", Err: io.ErrUnexpectedEOF},
+		{Raw: "9f01", Err: io.ErrUnexpectedEOF},
+		{Raw: "c1", Err: io.ErrUnexpectedEOF},
+		{Raw: "bbffffffffffffffff", Err: ErrTooLarge},
+		{Raw: "ff", Offset: 0},
+		{Raw: "1c", Offset: 0},
+		{Raw: "1f", Offset: 0},
+		{Raw: "8201ff", Offset: 2},
+		{Raw: "bf01ff", Offset: 2},
+		{Raw: "5f01ff", Offset: 1},
+		{Raw: "5f5f4100ffff", Offset: 1},
+		{Raw: "82019f821c", Offset: 4},
+	}
+	for i, d := range data {
+		bs, _ := hex.DecodeString(d.Raw)
+		_, err := Skip(bytes.NewReader(bs))
+		if d.Err != nil {
+			if err != d.Err {
+				t.Errorf("%d: unexpected error: want %v, got %v", i+1, d.Err, err)
+			}
+			continue
+		}
+		var se *SyntaxError
+		if !errors.As(err, &se) || se.Offset != d.Offset {
+			t.Errorf("%d: want syntax error at offset %d, got %v", i+1, d.Offset, err)
+		}
+	}
+}
+
+func TestSkipErrorOffset(t *testing.T) {
+	bs, _ := hex.DecodeString("00bf01ff")
+	dec := NewDecoder(bytes.NewReader(bs))
+	var se *SyntaxError
+	if _, err := dec.Skip(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if _, err := dec.Skip(); !errors.As(err, &se) || se.Offset != 3 {
+		t.Errorf("decoder: want syntax error at offset 3, got %v", err)
+	}
+
+	bs, _ = hex.DecodeString("a26161016162ff")
+	dec = NewDecoderBytes(bs)
+	dec.AllowUnknownFields(true)
+	if err := dec.Decode(new(struct{ A int })); !errors.As(err, &se) || se.Offset != 6 {
+		t.Errorf("unknown field: want syntax error at offset 6, got %v", err)
+	}
+}
+
+func TestDecoderSkip(t *testing.T) {
+	bs, _ := hex.DecodeString("a3616101616282020361639f01ff")
+	d := NewDecoder(bytes.NewReader(bs))
+	if _, err := d.Token(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	var keys []string
+	for d.More() {
+		var k string
+		if err := d.Decode(&k); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		n, err := d.Skip()
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		keys = append(keys, k+string(rune('0'+n)))
+	}
+	if len(keys) != 3 || keys[0] != "a1" || keys[1] != "b3" || keys[2] != "c3" {
+		t.Errorf("unexpected keys: %v", keys)
+	}
+	if _, err := d.Token(); err != io.EOF {
+		t.Errorf("expected EOF, got %v", err)
+	}
+}
+
+func TestSkipAllocs(t *testing.T) {
+	bs, _ := hex.DecodeString("bf61619f5f4201024103ff7f6161ff83010203ff6162a1c11a514b67b0fb3ff199999999999aff")
+	var (
+		br = bytes.NewReader(bs)
+		r  = bufio.NewReader(br)
+	)
+	n := testing.AllocsPerRun(100, func() {
+		br.Reset(bs)
+		r.Reset(br)
+		if n, err := Skip(r); err != nil || n != int64(len(bs)) {
+			t.Fatalf("unexpected result: %d, %v", n, err)
+		}
+	})
+	if n != 0 {
+		t.Errorf("Skip allocates %f times", n)
+	}
+}
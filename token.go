@@ -0,0 +1,173 @@
+package cbor
+
+import (
+	"io"
+)
+
+// frame is a container or an indefinite length string being read by Token.
+type frame struct {
+	major byte
+	indef bool
+	// n is the number of items left in definite length containers and the
+	// number of items read in indefinite length ones.
+	n uint64
+}
+
+// Token returns the header of the next data item in the input. It returns
+// io.EOF at the end of the input if no container is left open.
+//
+// Containers are not read as a whole: the tokens of their elements follow
+// their header, then a break code for indefinite lengths. Indefinite length
+// strings are followed by the headers of their chunks and a break code. The
+// payload of a string can be read with Payload or PayloadReader before the
+// next call to Token; otherwise it is skipped.
+func (d *Decoder) Token() (Header, error) {
+	d.complete()
+	if err := d.discard(); err != nil {
+		return Header{}, err
+	}
+	off := d.offset()
+	h, err := ReadHeader(d.r)
+	if err != nil {
+		if err == io.EOF && len(d.stack) > 0 {
+			err = io.ErrUnexpectedEOF
+		}
+		return h, shiftError(err, off)
+	}
+	top := d.top()
+	if top != nil && top.indef && (top.major == Bin || top.major == String) {
+		if h.IsBreak() {
+			d.stack = d.stack[:len(d.stack)-1]
+			return h, nil
+		}
+		if h.Major != top.major || h.Indefinite() {
+			return h, &SyntaxError{msg: "invalid chunk in indefinite length string", Offset: off}
+		}
+		d.pending = h.Arg
+		return h, nil
+	}
+	if h.IsBreak() {
+		if top == nil || !top.indef {
+			return h, &SyntaxError{msg: "unexpected break", Offset: off}
+		}
+		if top.major == Map && top.n%2 == 1 {
+			return h, &SyntaxError{msg: "missing value in indefinite length map", Offset: off}
+		}
+		d.stack = d.stack[:len(d.stack)-1]
+		return h, nil
+	}
+	d.enter()
+	switch h.Major {
+	case Array, Map:
+		f := frame{major: h.Major, indef: h.Indefinite(), n: h.Arg}
+		if h.Major == Map && !f.indef {
+			if f.n > f.n*2 {
+				return h, ErrTooLarge
+			}
+			f.n *= 2
+		}
+		d.stack = append(d.stack, f)
+	case Tag:
+		d.stack = append(d.stack, frame{major: Tag, n: 1})
+	case Bin, String:
+		if h.Indefinite() {
+			d.stack = append(d.stack, frame{major: h.Major, indef: true})
+		} else {
+			d.pending = h.Arg
+		}
+	}
+	return h, nil
+}
+
+// More reports whether there is another element in the current container or,
+// outside of any container, another data item in the input.
+//
+// Definite length containers have no token marking their end: the call to
+// More returning false for such a container closes it, so that the next call
+// applies to the enclosing container.
+func (d *Decoder) More() bool {
+	top := d.top()
+	if top != nil && !top.indef {
+		if top.n > 0 {
+			return true
+		}
+		d.stack = d.stack[:len(d.stack)-1]
+		return false
+	}
+	if err := d.discard(); err != nil {
+		return false
+	}
+	r := d.r.(io.ByteScanner)
+	b, err := r.ReadByte()
+	if err != nil {
+		return false
+	}
+	r.UnreadByte()
+	return top == nil || b != Break
+}
+
+// Payload reads the rest of the payload of the string or chunk returned by
+// the last call to Token.
+func (d *Decoder) Payload() ([]byte, error) {
+	return io.ReadAll(d.PayloadReader())
+}
+
+// PayloadReader returns a reader of the rest of the payload of the string or
+// chunk returned by the last call to Token.
+func (d *Decoder) PayloadReader() io.Reader {
+	return payloadReader{d}
+}
+
+type payloadReader struct {
+	d *Decoder
+}
+
+func (p payloadReader) Read(bs []byte) (int, error) {
+	if p.d.pending == 0 {
+		return 0, io.EOF
+	}
+	if uint64(len(bs)) > p.d.pending {
+		bs = bs[:p.d.pending]
+	}
+	n, err := p.d.r.Read(bs)
+	p.d.pending -= uint64(n)
+	if err == io.EOF && p.d.pending > 0 {
+		err = io.ErrUnexpectedEOF
+	}
+	return n, err
+}
+
+func (d *Decoder) top() *frame {
+	if len(d.stack) == 0 {
+		return nil
+	}
+	return &d.stack[len(d.stack)-1]
+}
+
+// enter counts a new item in the current container.
+func (d *Decoder) enter() {
+	if f := d.top(); f != nil {
+		if f.indef {
+			f.n++
+		} else {
+			f.n--
+		}
+	}
+}
+
+// complete closes the definite length containers whose items were all read
+// and that were not closed by More.
+func (d *Decoder) complete() {
+	for f := d.top(); f != nil && !f.indef && f.n == 0; f = d.top() {
+		d.stack = d.stack[:len(d.stack)-1]
+	}
+}
+
+// discard skips the part of the payload of the last string that was not read.
+func (d *Decoder) discard() error {
+	if d.pending == 0 {
+		return nil
+	}
+	_, err := io.Copy(io.Discard, d.PayloadReader())
+	return err
+}
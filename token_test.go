@@ -0,0 +1,145 @@
+package cbor
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+func TestDecoderToken(t *testing.T) {
+	data := []struct {
+		Raw  string
+		Want []string
+	}{
+		{Raw: "01", Want: []string{"0:1"}},
+		{Raw: "0102", Want: []string{"0:1", "0:2"}},
+		{Raw: "83010203", Want: []string{"4:3", "0:1", "0:2", "0:3"}},
+		{Raw: "9f0102ff", Want: []string{"4:_", "0:1", "0:2", "7:_"}},
+		{Raw: "a2616101616282f5f4", Want: []string{"5:2", "3:a", "0:1", "3:b", "4:2", "7:21", "7:20"}},
+		{Raw: "bf61619fff616280ff", Want: []string{"5:_", "3:a", "4:_", "7:_", "3:b", "4:0", "7:_"}},
+		{Raw: "7f6161626263ff", Want: []string{"3:_", "3:a", "3:bc", "7:_"}},
+		{Raw: "c11a514b67b0", Want: []string{"6:1", "0:1363896240"}},
+		{Raw: "4401020304", Want: []string{"2:01020304"}},
+		{Raw: "80a0", Want: []string{"4:0", "5:0"}},
+	}
+	for i, d := range data {
+		bs, _ := hex.DecodeString(d.Raw)
+		dec := NewDecoder(bytes.NewReader(bs))
+		var got []string
+		for {
+			h, err := dec.Token()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatalf("%d: unexpected error: %s", i+1, err)
+			}
+			got = append(got, formatToken(t, dec, h))
+		}
+		if strings.Join(got, " ") != strings.Join(d.Want, " ") {
+			t.Errorf("%d: want %v, got %v", i+1, d.Want, got)
+		}
+	}
+}
+
+func formatToken(t *testing.T, d *Decoder, h Header) string {
+	t.Helper()
+	var arg string
+	switch {
+	case h.Indefinite():
+		arg = "_"
+	case h.Major == Bin:
+		bs, err := d.Payload()
+		if err != nil {
+			t.Fatalf("fail to read payload: %s", err)
+		}
+		arg = hex.EncodeToString(bs)
+	case h.Major == String:
+		bs, err := io.ReadAll(iotest.OneByteReader(d.PayloadReader()))
+		if err != nil {
+			t.Fatalf("fail to read payload: %s", err)
+		}
+		arg = string(bs)
+	default:
+		arg = strconv.FormatUint(h.Arg, 10)
+	}
+	return fmt.Sprintf("%d:%s", h.Major>>5, arg)
+}
+
+func TestDecoderMore(t *testing.T) {
+	bs, _ := hex.DecodeString("9f6161a0ff8201026178")
+	d := NewDecoder(bytes.NewReader(bs))
+	var count []int
+	for d.More() {
+		h, err := d.Token()
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if h.Major != Array {
+			continue
+		}
+		var n int
+		for ; d.More(); n++ {
+			var v Value
+			if err := d.Decode(&v); err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+		}
+		if h.Indefinite() {
+			if h, err := d.Token(); err != nil || !h.IsBreak() {
+				t.Fatalf("expected break, got %+v (%v)", h, err)
+			}
+		}
+		count = append(count, n)
+	}
+	if len(count) != 2 || count[0] != 2 || count[1] != 2 {
+		t.Errorf("unexpected number of elements: %v", count)
+	}
+	if _, err := d.Token(); err != io.EOF {
+		t.Errorf("expected EOF, got %v", err)
+	}
+}
+
+func TestDecoderTokenErrors(t *testing.T) {
+	data := []struct {
+		Raw    string
+		Err    error
+		Offset int64
+	}{
+		{Raw: "8301", Err: io.ErrUnexpectedEOF},
+		{Raw: "9f01", Err: io.ErrUnexpectedEOF},
+		{Raw: "4401", Err: io.ErrUnexpectedEOF},
+		{Raw: "c1", Err: io.ErrUnexpectedEOF},
+		{Raw: "ff", Offset: 0},
+		{Raw: "8201ff", Offset: 2},
+		{Raw: "bf01ff", Offset: 2},
+		{Raw: "7f01ff", Offset: 1},
+		{Raw: "5f5f4100ffff", Offset: 1},
+		{Raw: "1c", Offset: 0},
+		{Raw: "82011c", Offset: 2},
+	}
+	for i, d := range data {
+		bs, _ := hex.DecodeString(d.Raw)
+		dec := NewDecoder(bytes.NewReader(bs))
+		var err error
+		for err == nil {
+			_, err = dec.Token()
+		}
+		if d.Err != nil {
+			if err != d.Err {
+				t.Errorf("%d: unexpected error: want %v, got %v", i+1, d.Err, err)
+			}
+			continue
+		}
+		var se *SyntaxError
+		if !errors.As(err, &se) || se.Offset != d.Offset {
+			t.Errorf("%d: want syntax error at offset %d, got %v", i+1, d.Offset, err)
+		}
+	}
+}
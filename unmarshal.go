@@ -1,13 +1,16 @@
 package cbor
 
 import (
-	// "bufio"
+	"bufio"
 	"bytes"
-	"encoding/binary"
 	"fmt"
 	"io"
+	"math"
 	"reflect"
-	"strings"
+	"strconv"
+	"sync"
+	"unicode/utf8"
+	"unsafe"
 )
 
 type reader interface {
@@ -16,200 +19,585 @@ type reader interface {
 }
 
 func Unmarshal(bs []byte, v interface{}) error {
-	r := bytes.NewReader(bs)
-	return unmarshal(r, reflect.ValueOf(v).Elem())
+	d := getDecoder(bs)
+	defer putDecoder(d)
+	return d.Decode(v)
 }
 
-func unmarshal(r reader, v reflect.Value) error {
+// Decoder reads and decodes successive CBOR items from an input stream.
+//
+// By default, decoding a map into a struct fails when the map has a key that
+// does not match any field of the struct.
+type Decoder struct {
+	r        reader
+	unknown  bool
+	utf8     UTF8Policy
+	preserve bool
+	zerocopy bool
+	unsafe   bool
+
+	maxDepth  int
+	maxLength int
+	depth     int
+
+	// state of the tokens read by Token
+	stack   []frame
+	pending uint64
+}
+
+func NewDecoder(r io.Reader) *Decoder {
+	rs, ok := r.(reader)
+	if _, peek := r.(io.ByteScanner); !ok || !peek {
+		rs = bufio.NewReader(r)
+	}
+	return &Decoder{r: &countReader{r: rs}, maxDepth: defaultMaxDepth}
+}
+
+// bytesDecoder is a Decoder reading from a slice that can be reused through
+// decoderPool.
+type bytesDecoder struct {
+	Decoder
+	sr sliceReader
+}
+
+var decoderPool = sync.Pool{
+	New: func() interface{} {
+		return new(bytesDecoder)
+	},
+}
+
+func getDecoder(bs []byte) *bytesDecoder {
+	d := decoderPool.Get().(*bytesDecoder)
+	d.sr = sliceReader{buf: bs}
+	d.Decoder = Decoder{r: &d.sr, stack: d.stack[:0], maxDepth: defaultMaxDepth}
+	return d
+}
+
+func putDecoder(d *bytesDecoder) {
+	d.sr.buf = nil
+	decoderPool.Put(d)
+}
+
+// NewDecoderBytes returns a Decoder reading the data items held by bs.
+func NewDecoderBytes(bs []byte) *Decoder {
+	return &Decoder{r: &sliceReader{buf: bs}, maxDepth: defaultMaxDepth}
+}
+
+// AllowUnknownFields makes the Decoder skip the values of map keys that have
+// no matching field in the destination struct instead of returning an error.
+func (d *Decoder) AllowUnknownFields(allow bool) {
+	d.unknown = allow
+}
+
+// PreserveEncoding makes the Decoder record how the items decoded into a
+// Value or an OrderedMap were encoded: width of the arguments and floats,
+// indefinite lengths and chunks of strings. Encoding them again gives the
+// same bytes as long as they are not modified.
+func (d *Decoder) PreserveEncoding(preserve bool) {
+	d.preserve = preserve
+}
+
+// ZeroCopy makes the byte strings decoded into []byte and Value, and the
+// items decoded into RawMessage, share the memory of the input instead of
+// being copied. It only applies to a Decoder created by NewDecoderBytes and
+// the input must not be modified while the decoded values are in use.
+func (d *Decoder) ZeroCopy(enable bool) {
+	d.zerocopy = enable
+}
+
+// UnsafeStrings makes the text strings decoded into Go strings share the
+// memory of the input instead of being copied. It only applies to a Decoder
+// created by NewDecoderBytes. Since Go strings are immutable, the input must
+// never be modified once decoded.
+func (d *Decoder) UnsafeStrings(enable bool) {
+	d.unsafe = enable
+}
+
+// SetUTF8Policy sets how the Decoder handles text strings that are not valid
+// UTF-8. By default, they are rejected.
+func (d *Decoder) SetUTF8Policy(p UTF8Policy) {
+	d.utf8 = p
+}
+
+// SetMaxDepth sets the maximum number of nested arrays, maps and tags of the
+// items decoded. It defaults to 10000 so that deeply nested input can not
+// exhaust the stack. Zero means no limit.
+func (d *Decoder) SetMaxDepth(n int) {
+	d.maxDepth = n
+}
+
+// SetMaxLength sets the maximum length of the strings and the maximum number
+// of elements of the arrays and maps decoded. Zero means no limit.
+func (d *Decoder) SetMaxLength(n int) {
+	d.maxLength = n
+}
+
+// offset returns the number of bytes read from the input.
+func (d *Decoder) offset() int64 {
+	switch r := d.r.(type) {
+	case *sliceReader:
+		return int64(r.pos)
+	case *countReader:
+		return r.n
+	default:
+		return -1
+	}
+}
+
+// peek returns the next byte of the input without consuming it.
+func (d *Decoder) peek() (byte, error) {
+	r := d.r.(io.ByteScanner)
 	b, err := r.ReadByte()
 	if err != nil {
+		return b, err
+	}
+	return b, r.UnreadByte()
+}
+
+// defaultMaxDepth is the maximum depth of a Decoder unless set with
+// SetMaxDepth.
+const defaultMaxDepth = 10000
+
+// nest increments the depth of the items being decoded. The item starting at
+// off is rejected if it is too deep.
+func (d *Decoder) nest(off int64) error {
+	d.depth++
+	if d.maxDepth > 0 && d.depth > d.maxDepth {
+		return &MaxLimitError{Limit: "depth", Max: d.maxDepth, Offset: off}
+	}
+	return nil
+}
+
+// checkLength rejects the item starting at off if its length n is too large.
+func (d *Decoder) checkLength(n uint64, off int64) error {
+	if d.maxLength > 0 && n > uint64(d.maxLength) {
+		return &MaxLimitError{Limit: "length", Max: d.maxLength, Offset: off}
+	}
+	return nil
+}
+
+// Decode decodes the next data item into v. It can be mixed with calls to
+// Token to decode the elements of a container.
+func (d *Decoder) Decode(v interface{}) error {
+	d.complete()
+	if err := d.discard(); err != nil {
 		return err
 	}
-	switch m, a, k := b&0xE0, b&0x1F, v.Kind(); m {
+	d.enter()
+	d.depth = 0
+	off := d.offset()
+	err := unmarshal(d, reflect.ValueOf(v).Elem())
+	// io.EOF is only returned when the input ends before the item
+	if (err == io.EOF && d.offset() != off) || err == io.ErrUnexpectedEOF {
+		err = &SyntaxError{msg: "unexpected end of input", Offset: d.offset(), err: io.ErrUnexpectedEOF}
+	}
+	return err
+}
+
+func unmarshal(d *Decoder, v reflect.Value) error {
+	return typeDecoder(v.Type())(d, v)
+}
+
+func newTypeDecoder(t reflect.Type) decoderFunc {
+	switch t {
+	case rawType:
+		return unmarshalRaw
+	case valueType:
+		return unmarshalValue
+	case orderedMapType:
+		return unmarshalOrdered
+	}
+	var c itemDecoder
+	switch t.Kind() {
+	case reflect.Ptr:
+		elem := typeDecoder(t.Elem())
+		return func(d *Decoder, v reflect.Value) error {
+			// null and undefined leave the pointer nil without allocating
+			// the value it would point to
+			b, err := d.peek()
+			if err != nil {
+				return err
+			}
+			if b == Other|Nil || b == Other|Undefined {
+				d.r.ReadByte()
+				v.Set(reflect.Zero(t))
+				return nil
+			}
+			if v.IsNil() {
+				v.Set(reflect.New(t.Elem()))
+			}
+			return elem(d, v.Elem())
+		}
+	case reflect.Slice, reflect.Array:
+		c.elem = typeDecoder(t.Elem())
+	case reflect.Map:
+		c.key, c.elem = typeDecoder(t.Key()), typeDecoder(t.Elem())
+	case reflect.Struct:
+		c.st = cachedStruct(t)
+		if c.st.err != nil {
+			return func(*Decoder, reflect.Value) error {
+				return c.st.err
+			}
+		}
+		c.fields = make([]decoderFunc, len(c.st.fields))
+		for i, f := range c.st.fields {
+			c.fields[i] = typeDecoder(t.Field(f.index).Type)
+		}
+	}
+	return c.decode
+}
+
+// itemDecoder decodes a data item according to its major type. It holds the
+// decoders of the elements of the containers it can decode.
+type itemDecoder struct {
+	key    decoderFunc
+	elem   decoderFunc
+	st     *structCodec
+	fields []decoderFunc
+}
+
+func (c *itemDecoder) decode(d *Decoder, v reflect.Value) error {
+	h, off, err := d.header()
+	if err != nil {
+		return err
+	}
+	if h.IsBreak() {
+		return &SyntaxError{msg: "unexpected break", Offset: off}
+	}
+	m := h.Major
+	nested := m == Array || m == Map || m == Tag
+	if nested {
+		if err := d.nest(off); err != nil {
+			return err
+		}
+	}
+	switch k := v.Kind(); m {
 	case Uint:
-		err = unmarshalUint(r, a, v)
+		err = unmarshalUint(h, v)
 	case Int:
-		err = unmarshalInt(r, a, v)
+		err = unmarshalInt(h, v)
 	case Bin:
+		err = unmarshalBytes(d, h, v)
 	case String:
-		err = unmarshalString(r, a, v)
+		err = unmarshalString(d, h, v)
 	case Array:
-		err = unmarshalArray(r, a, v)
+		err = unmarshalArray(d, h, v, c.elem)
 	case Map:
-		if k == reflect.Map {
-			return unmarshalMap(r, a, v)
-		}
-		if k == reflect.Struct || k == reflect.Ptr {
-			return unmarshalStruct(r, a, v)
+		switch k {
+		case reflect.Map:
+			err = unmarshalMap(d, h, v, c.key, c.elem)
+		case reflect.Struct:
+			err = unmarshalStruct(d, h, v, c)
+		default:
+			err = expectedType(h, v.Type())
 		}
-		return expectedType("map/struct", k)
 	case Other:
-		return unmarshalSimple(r, a, v)
+		err = unmarshalSimple(h, v)
 	case Tag:
-		return unmarshalTagged(r, a, v)
+		err = unmarshalTagged(d, h, v)
+	}
+	if nested {
+		d.depth--
+	}
+	// type and UTF-8 errors are created without knowing where the item
+	// starts
+	switch e := err.(type) {
+	case *UnmarshalTypeError:
+		if e.Offset < 0 {
+			e.Offset = off
+		}
+	case *InvalidUTF8Error:
+		if e.Offset < 0 {
+			e.Offset = off
+		}
 	}
 	return err
 }
 
-func unmarshalTagged(r reader, a byte, v reflect.Value) error {
-	switch a {
-	default:
-	case Len1:
-		b, err := r.ReadByte()
-		if err != nil {
-			return err
-		}
-		a = b
-	case Len2:
-	case Len4:
-	case Len8:
+// header reads the header of the next data item and returns the offset
+// where the item starts. Simple values below 32 encoded on two bytes are not
+// well-formed.
+func (d *Decoder) header() (Header, int64, error) {
+	off := d.offset()
+	h, err := ReadHeader(d.r)
+	if err == nil && h.Major == Other && h.Info == Simple && h.Arg < 32 {
+		err = &SyntaxError{msg: fmt.Sprintf("invalid simple value %d", h.Arg)}
 	}
-	switch a {
-	default:
-		return fmt.Errorf("unsupported tagged item %02x", a)
+	return h, off, shiftError(err, off)
+}
+
+// length returns the number of items of the container of header h. Only
+// definite length containers can be decoded into maps, slices and structs.
+func (d *Decoder) length(h Header) (int, error) {
+	off := d.offset() - 1 - int64(h.size())
+	if h.Indefinite() {
+		return 0, fmt.Errorf("indefinite length %s not supported", kindOf(h.Major, h.Info))
+	}
+	size, err := h.length()
+	if err != nil {
+		return 0, err
+	}
+	return size, d.checkLength(uint64(size), off)
+}
+
+func unmarshalValue(d *Decoder, v reflect.Value) error {
+	x, err := decodeValue(d)
+	if err == nil {
+		v.Set(reflect.ValueOf(x))
+	}
+	return err
+}
+
+func unmarshalTagged(d *Decoder, h Header, v reflect.Value) error {
+	switch n := h.Arg; n {
 	case TagURI, TagRFC3339, TagUnix:
-		return unmarshal(r, v)
+		return unmarshal(d, v)
+	default:
+		return fmt.Errorf("unsupported tagged item %02x", n)
 	}
-	return nil
 }
 
-func unmarshalSimple(r reader, a byte, v reflect.Value) error {
-	switch k := v.Kind(); a {
+func unmarshalSimple(h Header, v reflect.Value) error {
+	switch k := v.Kind(); h.Info {
 	default:
 		if isInt(k) {
-			v.SetInt(int64(a))
-		} else if isUint(k) {
-			v.SetUint(uint64(a))
-		} else {
-			return expectedType("int/uint", k)
-		}
-	case Simple:
-		b, err := r.ReadByte()
-		if err != nil {
-			return err
-		}
-		if isInt(k) {
-			v.SetInt(int64(b))
+			v.SetInt(int64(h.Arg))
 		} else if isUint(k) {
-			v.SetUint(uint64(b))
+			v.SetUint(h.Arg)
 		} else {
-			return expectedType("int/uint", k)
-		}
-	case False:
-		if k != reflect.Bool {
-			return expectedType("bool", k)
+			return expectedType(h, v.Type())
 		}
-		v.SetBool(false)
-	case True:
+	case False, True:
 		if k != reflect.Bool {
-			return expectedType("bool", k)
+			return expectedType(h, v.Type())
 		}
-		v.SetBool(true)
+		v.SetBool(h.Info == True)
 	case Nil, Undefined:
-	case Float16:
-		return fmt.Errorf("float16 not yet supported")
-	case Float32:
-		if k == reflect.Float32 || k == reflect.Float64 {
-			var f float32
-			if err := binary.Read(r, binary.BigEndian, &f); err != nil {
-				return err
-			}
-			v.SetFloat(float64(f))
-		} else {
-			return expectedType("float32", k)
-		}
-	case Float64:
-		if k == reflect.Float64 {
-			var f float64
-			if err := binary.Read(r, binary.BigEndian, &f); err != nil {
-				return err
-			}
-			v.SetFloat(f)
-		} else {
-			return expectedType("float64", k)
+	case Float16, Float32, Float64:
+		if !isFloat(k) || (h.Info == Float64 && k != reflect.Float64) {
+			return expectedType(h, v.Type())
 		}
+		f, _ := h.Float()
+		v.SetFloat(f)
 	}
 	return nil
 }
 
-func unmarshalMap(r reader, a byte, v reflect.Value) error {
-	size, err := sizeof(r, a)
+func unmarshalMap(d *Decoder, h Header, v reflect.Value, key, elem decoderFunc) error {
+	size, err := d.length(h)
 	if err != nil {
 		return err
 	}
+	t := v.Type()
 	if v.IsNil() {
-		v.Set(reflect.MakeMapWithSize(v.Type(), size))
+		v.Set(reflect.MakeMapWithSize(t, size))
 	}
-	seen := make(map[string]struct{})
+	seen := make(map[interface{}]struct{}, size)
 	for i := 0; i < size; i++ {
-		k := reflect.New(v.Type().Key()).Elem()
-		if err := unmarshal(r, k); err != nil {
+		var (
+			k    = reflect.New(t.Key()).Elem()
+			koff = d.offset()
+		)
+		if err := key(d, k); err != nil {
 			return err
 		}
-		if _, ok := seen[k.String()]; ok {
-			return fmt.Errorf("duplicate field %s", k)
+		if _, ok := seen[k.Interface()]; ok {
+			return &DuplicateKeyError{Key: fmt.Sprint(k), Offset: koff, Path: keySegment(k)}
 		}
-		seen[k.String()] = struct{}{}
+		seen[k.Interface()] = struct{}{}
 
-		f := reflect.New(v.Type().Elem()).Elem()
-		if err := unmarshal(r, f); err != nil {
-			return err
+		f := reflect.New(t.Elem()).Elem()
+		if err := elem(d, f); err != nil {
+			return atPath(err, keySegment(k))
 		}
 		v.SetMapIndex(k, f)
 	}
 	return nil
 }
 
-func unmarshalStruct(r reader, a byte, v reflect.Value) error {
-	size, err := sizeof(r, a)
+func unmarshalOrdered(d *Decoder, v reflect.Value) error {
+	off := d.offset()
+	x, err := decodeValue(d)
 	if err != nil {
 		return err
 	}
-	vs := make(map[string]reflect.Value)
-	for i, t := 0, v.Type(); i < v.NumField(); i++ {
-		f := v.Field(i)
-		if !f.CanSet() {
-			continue
+	if x.Kind() != KindMap {
+		return &UnmarshalTypeError{CBORType: x.Kind().String(), GoType: v.Type(), Offset: off}
+	}
+	v.Set(reflect.ValueOf(x.dict).Elem())
+	return nil
+}
+
+func unmarshalStruct(d *Decoder, h Header, v reflect.Value, c *itemDecoder) error {
+	size, err := d.length(h)
+	if err != nil {
+		return err
+	}
+	var (
+		// seen is a bit set of the fields already decoded
+		small [1]uint64
+		seen  = small[:]
+		other map[string]struct{}
+		// keys holds the deterministic encoding of the keys that are not
+		// text strings
+		keys map[string]struct{}
+	)
+	if n := len(c.fields); n > 64 {
+		seen = make([]uint64, (n+63)/64)
+	}
+	for i := 0; i < size; i++ {
+		koff := d.offset()
+		b, err := d.peek()
+		if err != nil {
+			return err
 		}
-		j := t.Field(i)
-		switch n := j.Tag.Get("cbor"); strings.ToLower(n) {
-		case "-":
+		if b&0xE0 != String {
+			if keys == nil {
+				keys = make(map[string]struct{})
+			}
+			if err := unmarshalKey(d, v, c.st.extra, keys, koff); err != nil {
+				return err
+			}
 			continue
-		case "":
-			vs[j.Name] = f
-		default:
-			vs[n] = f
 		}
-	}
-	seen := make(map[string]struct{})
-	for i := 0; i < size; i++ {
-		var k string
-		f := reflect.New(reflect.TypeOf(k)).Elem()
-		if err := unmarshal(r, f); err != nil {
+		name, err := d.fieldName()
+		if err != nil {
 			return err
 		}
-		k = f.String()
-		if _, ok := seen[k]; ok {
-			return fmt.Errorf("duplicate field %s", k)
+		j, ok := c.st.byName[string(name)]
+		if ok {
+			f := c.st.fields[j]
+			if seen[j/64]&(1<<(j%64)) != 0 {
+				return &DuplicateKeyError{Key: f.name, Offset: koff, Path: "." + f.name}
+			}
+			seen[j/64] |= 1 << (j % 64)
+			if err := c.fields[j](d, v.Field(f.index)); err != nil {
+				return atPath(err, "."+f.name)
+			}
+			continue
+		}
+		k := string(name)
+		if _, ok := other[k]; ok {
+			return &DuplicateKeyError{Key: k, Offset: koff, Path: "." + k}
+		}
+		if other == nil {
+			other = make(map[string]struct{})
 		}
-		seen[k] = struct{}{}
+		other[k] = struct{}{}
 
-		f, ok := vs[k]
-		if !ok {
-			return fmt.Errorf("field not found %s", k)
+		if c.st.extra >= 0 {
+			if err := unmarshalExtra(d, reflect.ValueOf(k), v.Field(c.st.extra)); err != nil {
+				return atPath(err, "."+k)
+			}
+			continue
 		}
-		if err := unmarshal(r, f); err != nil {
+		if !d.unknown {
+			return &UnknownFieldError{Field: k, GoType: v.Type(), Offset: koff, Path: "." + k}
+		}
+		if err := d.skipItem(); err != nil {
 			return err
 		}
 	}
 	return nil
 }
 
-func unmarshalArray(r reader, a byte, v reflect.Value) error {
+// unmarshalKey handles a key of a map decoded into a struct that is not a
+// text string and can not match any field. Its entry is captured by the
+// extra field of index extra if the keys of its map can hold it. Otherwise,
+// its value is skipped if unknown fields are allowed.
+func unmarshalKey(d *Decoder, v reflect.Value, extra int, seen map[string]struct{}, off int64) error {
+	k, err := decodeValue(d)
+	if err != nil {
+		return err
+	}
+	id, seg := keyOf(k), valueSegment(k)
+	if _, ok := seen[id]; ok {
+		return &DuplicateKeyError{Key: k.String(), Offset: off, Path: seg}
+	}
+	seen[id] = struct{}{}
+	if extra >= 0 {
+		f := v.Field(extra)
+		if kv, ok := extraKey(k, f.Type().Key()); ok {
+			return atPath(unmarshalExtra(d, kv, f), seg)
+		}
+	}
+	if !d.unknown {
+		return &UnknownFieldError{Field: k.String(), GoType: v.Type(), Offset: off, Path: seg}
+	}
+	return d.skipItem()
+}
+
+var stringType = reflect.TypeOf("")
+
+// fieldName reads the payload of a map key decoded into a struct. It is only
+// valid until the next read when the Decoder reads from a slice.
+func (d *Decoder) fieldName() ([]byte, error) {
+	h, off, err := d.header()
+	if err != nil {
+		return nil, err
+	}
+	if h.Major != String {
+		return nil, &UnmarshalTypeError{CBORType: kindOf(h.Major, h.Info).String(), GoType: stringType, Offset: off}
+	}
+	name, _, err := d.payload(h, true)
+	if err != nil {
+		return nil, err
+	}
+	if !utf8.Valid(name) {
+		if d.utf8 != UTF8Replace {
+			return nil, &InvalidUTF8Error{Offset: off}
+		}
+		name = bytes.ToValidUTF8(name, []byte(string(utf8.RuneError)))
+	}
+	return name, nil
+}
+
+// extraKey returns the Go value of the key k that is not a text string if
+// it can be held by the keys of type t of an extra field. Only integers,
+// floats and booleans are kept, as the values of interface keys.
+func extraKey(k Value, t reflect.Type) (reflect.Value, bool) {
+	var x interface{}
+	switch k.Kind() {
+	case KindUint:
+		x, _ = k.Uint()
+	case KindInt:
+		n, err := k.Int()
+		if err != nil {
+			return reflect.Value{}, false
+		}
+		x = n
+	case KindFloat:
+		x, _ = k.Float()
+	case KindBool:
+		x, _ = k.Bool()
+	}
+	if x == nil || t.Kind() != reflect.Interface || !reflect.TypeOf(x).Implements(t) {
+		return reflect.Value{}, false
+	}
+	return reflect.ValueOf(x), true
+}
+
+func unmarshalExtra(d *Decoder, k reflect.Value, v reflect.Value) error {
+	raw, err := d.raw()
+	if err != nil {
+		return err
+	}
+	t := v.Type()
+	if !k.Type().ConvertibleTo(t.Key()) || !rawType.ConvertibleTo(t.Elem()) {
+		return fmt.Errorf("extra field: unsupported map type %s", t)
+	}
+	if v.IsNil() {
+		v.Set(reflect.MakeMap(t))
+	}
+	v.SetMapIndex(k.Convert(t.Key()), reflect.ValueOf(RawMessage(raw)).Convert(t.Elem()))
+	return nil
+}
+
+func unmarshalArray(d *Decoder, h Header, v reflect.Value, elem decoderFunc) error {
 	if k := v.Kind(); !(k == reflect.Array || k == reflect.Slice) {
-		return expectedType("array/slice", k)
+		return expectedType(h, v.Type())
 	}
-	size, err := sizeof(r, a)
+	size, err := d.length(h)
 	if err != nil {
 		return err
 	}
@@ -226,8 +614,8 @@ func unmarshalArray(r reader, a byte, v reflect.Value) error {
 		} else {
 			f = reflect.New(v.Type().Elem()).Elem()
 		}
-		if err := unmarshal(r, f); err != nil {
-			return err
+		if err := elem(d, f); err != nil {
+			return atPath(err, indexSegment(i))
 		}
 		if i >= v.Len() {
 			v.Set(reflect.Append(v, f))
@@ -236,93 +624,196 @@ func unmarshalArray(r reader, a byte, v reflect.Value) error {
 	return nil
 }
 
-func unmarshalString(r reader, a byte, v reflect.Value) error {
-	if k := v.Kind(); k != reflect.String {
-		return expectedType("string", k)
-	}
-	size, err := sizeof(r, a)
+func unmarshalRaw(d *Decoder, v reflect.Value) error {
+	raw, err := d.raw()
 	if err != nil {
 		return err
 	}
+	v.SetBytes(raw)
+	return nil
+}
+
+// skipItem discards the next data item. Its syntax errors give offsets in
+// the input.
+func (d *Decoder) skipItem() error {
+	off := d.offset()
+	return shiftError(skipItem(d.r), off)
+}
+
+// raw returns the encoded bytes of the next data item.
+func (d *Decoder) raw() ([]byte, error) {
+	off := d.offset()
+	sr, ok := d.r.(*sliceReader)
+	if !ok {
+		raw, err := readRaw(d.r)
+		return raw, shiftError(err, off)
+	}
+	start := sr.pos
+	if err := skipItem(sr); err != nil {
+		return nil, shiftError(err, off)
+	}
+	raw := sr.buf[start:sr.pos]
+	if d.zerocopy {
+		return raw, nil
+	}
+	return append(make([]byte, 0, len(raw)), raw...), nil
+}
+
+// payload reads the payload of a string of header h. The chunks of indefinite length strings are concatenated.
+// The payload of definite length strings is shared with the input if alias is
+// set and the Decoder reads from a slice; the second value reports whether it
+// is.
+func (d *Decoder) payload(h Header, alias bool) ([]byte, bool, error) {
+	off := d.offset() - 1 - int64(h.size())
+	if h.Indefinite() {
+		var bs []byte
+		for {
+			c, coff, err := d.header()
+			if err != nil {
+				return nil, false, unexpected(err)
+			}
+			if c.IsBreak() {
+				break
+			}
+			if c.Major != h.Major || c.Indefinite() {
+				return nil, false, &SyntaxError{msg: "invalid chunk in indefinite length string", Offset: coff}
+			}
+			chunk, _, err := d.payload(c, true)
+			if err != nil {
+				return nil, false, err
+			}
+			bs = append(bs, chunk...)
+			if err := d.checkLength(uint64(len(bs)), off); err != nil {
+				return nil, false, err
+			}
+		}
+		if bs == nil {
+			bs = []byte{}
+		}
+		return bs, false, nil
+	}
+	if err := d.checkLength(h.Arg, off); err != nil {
+		return nil, false, err
+	}
+	return d.read(h.Arg, alias)
+}
+
+// read reads the next size bytes of the input. See payload for alias.
+func (d *Decoder) read(size uint64, alias bool) ([]byte, bool, error) {
+	if sr, ok := d.r.(*sliceReader); ok {
+		bs, err := sr.next(size)
+		if err != nil || alias {
+			return bs, err == nil, err
+		}
+		return append(make([]byte, 0, len(bs)), bs...), false, nil
+	}
+	if size > math.MaxInt32 {
+		return nil, false, ErrTooLarge
+	}
 	bs := make([]byte, size)
-	if _, err := io.ReadFull(r, bs); err != nil {
-		return err
+	if _, err := io.ReadFull(d.r, bs); err != nil {
+		return nil, false, unexpected(err)
 	}
-	v.SetString(string(bs))
-	// v.SetBytes(bs)
-	return nil
+	return bs, false, nil
 }
 
-func unmarshalInt(r reader, a byte, v reflect.Value) error {
-	var (
-		i   int64
-		err error
-	)
-	switch a {
+func unmarshalBytes(d *Decoder, h Header, v reflect.Value) error {
+	switch k := v.Kind(); {
+	case k == reflect.Slice && v.Type().Elem().Kind() == reflect.Uint8:
+		bs, _, err := d.payload(h, d.zerocopy)
+		if err != nil {
+			return err
+		}
+		v.SetBytes(bs)
+	case k == reflect.Array && v.Type().Elem().Kind() == reflect.Uint8:
+		bs, _, err := d.payload(h, true)
+		if err != nil {
+			return err
+		}
+		if len(bs) > v.Len() {
+			return fmt.Errorf("array length too short (got: %d, want: %d)", v.Len(), len(bs))
+		}
+		reflect.Copy(v, reflect.ValueOf(bs))
 	default:
-		i = int64(a)
-	case Len1:
-		var v int8
-		err = binary.Read(r, binary.BigEndian, &v)
-		i = int64(v)
-	case Len2:
-		var v int16
-		err = binary.Read(r, binary.BigEndian, &v)
-		i = int64(v)
-	case Len4:
-		var v int32
-		err = binary.Read(r, binary.BigEndian, &v)
-		i = int64(v)
-	case Len8:
-		var v int64
-		err = binary.Read(r, binary.BigEndian, &v)
-		i = int64(v)
+		return expectedType(h, v.Type())
+	}
+	return nil
+}
+
+// recorder keeps a copy of all the bytes read from the underlying reader.
+type recorder struct {
+	reader
+	buf []byte
+}
+
+func (r *recorder) ReadByte() (byte, error) {
+	b, err := r.reader.ReadByte()
+	if err == nil {
+		r.buf = append(r.buf, b)
+	}
+	return b, err
+}
+
+func (r *recorder) Read(bs []byte) (int, error) {
+	n, err := r.reader.Read(bs)
+	r.buf = append(r.buf, bs[:n]...)
+	return n, err
+}
+
+// readRaw returns the encoded bytes of the next data item in r.
+func readRaw(r reader) ([]byte, error) {
+	rs := recorder{reader: r}
+	if err := skipItem(&rs); err != nil {
+		return nil, err
+	}
+	return rs.buf, nil
+}
+
+func unmarshalString(d *Decoder, h Header, v reflect.Value) error {
+	if k := v.Kind(); k != reflect.String {
+		return expectedType(h, v.Type())
 	}
+	bs, alias, err := d.payload(h, d.unsafe)
 	if err != nil {
 		return err
 	}
-	if k := v.Kind(); !isInt(k) {
-		return expectedType("int", k)
+	if !utf8.Valid(bs) {
+		if d.utf8 != UTF8Replace {
+			return &InvalidUTF8Error{Offset: -1}
+		}
+		bs, alias = bytes.ToValidUTF8(bs, []byte(string(utf8.RuneError))), false
+	}
+	if len(bs) == 0 {
+		v.SetString("")
+	} else if alias && !d.unsafe {
+		v.SetString(string(bs))
+	} else {
+		// bs is either a copy owned by v or shared with an input the caller
+		// promised not to modify.
+		v.SetString(unsafe.String(&bs[0], len(bs)))
 	}
-	v.SetInt(-1 - int64(i))
 	return nil
 }
 
-func unmarshalUint(r reader, a byte, v reflect.Value) error {
-	var (
-		i   uint64
-		err error
-	)
-	switch a {
-	default:
-		i = uint64(a)
-	case Len1:
-		var v uint8
-		err = binary.Read(r, binary.BigEndian, &v)
-		i = uint64(v)
-	case Len2:
-		var v uint16
-		err = binary.Read(r, binary.BigEndian, &v)
-		i = uint64(v)
-	case Len4:
-		var v uint32
-		err = binary.Read(r, binary.BigEndian, &v)
-		i = uint64(v)
-	case Len8:
-		var v uint64
-		err = binary.Read(r, binary.BigEndian, &v)
-		i = uint64(v)
+func unmarshalInt(h Header, v reflect.Value) error {
+	if k := v.Kind(); !isInt(k) {
+		return expectedType(h, v.Type())
 	}
-	if err != nil {
-		return err
+	if h.Arg > math.MaxInt64 {
+		return ErrOutOfRange
 	}
+	v.SetInt(-1 - int64(h.Arg))
+	return nil
+}
+
+func unmarshalUint(h Header, v reflect.Value) error {
 	switch k := v.Kind(); {
 	case isUint(k):
-		v.SetUint(i)
+		v.SetUint(h.Arg)
 	case isInt(k):
-		v.SetInt(int64(i))
+		v.SetInt(int64(h.Arg))
 	default:
-		return expectedType("uint/int", k)
+		return expectedType(h, v.Type())
 	}
 	return nil
 }
@@ -339,6 +830,22 @@ func isFloat(k reflect.Kind) bool {
 	return k == reflect.Float32 || k == reflect.Float64
 }
 
-func expectedType(n string, k reflect.Kind) error {
-	return fmt.Errorf("expected %s, got %s", n, k)
+// expectedType returns the error for an item of header h that can not be
+// decoded into a value of type t. Its offset is set by the caller knowing
+// where the item starts.
+func expectedType(h Header, t reflect.Type) error {
+	return &UnmarshalTypeError{CBORType: kindOf(h.Major, h.Info).String(), GoType: t, Offset: -1}
+}
+
+func indexSegment(i int) string {
+	return "[" + strconv.Itoa(i) + "]"
+}
+
+// keySegment returns the segment of the path of the value of the key k of a
+// Go map.
+func keySegment(k reflect.Value) string {
+	if k.Kind() == reflect.String {
+		return "." + k.String()
+	}
+	return fmt.Sprintf("[%v]", k)
 }
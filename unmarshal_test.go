@@ -1,7 +1,10 @@
 package cbor
 
 import (
+	"bytes"
 	"encoding/hex"
+	"errors"
+	"io"
 	"reflect"
 	"testing"
 )
@@ -75,7 +78,7 @@ func TestUnmarshalInt(t *testing.T) {
 		{Raw: "3863", Want: -100},
 		{Raw: "3903e7", Want: -1000},
 		{Raw: "f0", Want: 16},
-		{Raw: "f818", Want: 24},
+		{Raw: "f820", Want: 32},
 		{Raw: "f8ff", Want: 255},
 	}
 	for i, d := range data {
@@ -102,7 +105,7 @@ func TestUnmarshalUint(t *testing.T) {
 		{Raw: "1818", Want: 24},
 		{Raw: "1819", Want: 25},
 		{Raw: "f0", Want: 16},
-		{Raw: "f818", Want: 24},
+		{Raw: "f820", Want: 32},
 		{Raw: "f8ff", Want: 255},
 	}
 	for i, d := range data {
@@ -128,6 +131,8 @@ func TestUnmarshalStrings(t *testing.T) {
 			{Raw: "6449455446", Want: "IETF"},
 			{Raw: "62c3bc", Want: "\u00fc"},
 			{Raw: "63e6b0b4", Want: "\u6c34"},
+			{Raw: "7f657374726561646d696e67ff", Want: "streaming"},
+			{Raw: "7fff", Want: ""},
 		}
 		for i, d := range data {
 			var got string
@@ -164,6 +169,109 @@ func TestUnmarshalStrings(t *testing.T) {
 	})
 }
 
+func TestUnmarshalBytes(t *testing.T) {
+	data := []struct {
+		Raw  string
+		Want []byte
+	}{
+		{Raw: "40", Want: []byte{}},
+		{Raw: "4401020304", Want: []byte{1, 2, 3, 4}},
+		{Raw: "5f42010243030405ff", Want: []byte{1, 2, 3, 4, 5}},
+	}
+	for i, d := range data {
+		var got []byte
+		if err := decodeAndUnmarshal(d.Raw, &got); err != nil {
+			t.Errorf("unmarshal fail (%d): %v", i+1, err)
+			continue
+		}
+		if !bytes.Equal(got, d.Want) {
+			t.Errorf("%d value badly decoded: want %x, got %x", i+1, d.Want, got)
+		}
+	}
+	var arr [4]byte
+	if err := decodeAndUnmarshal("43010203", &arr); err != nil || arr != [4]byte{1, 2, 3, 0} {
+		t.Errorf("value badly decoded: %x (%v)", arr, err)
+	}
+	if err := decodeAndUnmarshal("450102030405", &arr); err == nil {
+		t.Errorf("expected error for too short array")
+	}
+	if err := decodeAndUnmarshal("440102", new([]byte)); err == nil {
+		t.Errorf("expected error for truncated input")
+	}
+}
+
+func TestUnmarshalPointer(t *testing.T) {
+	type T struct {
+		A *int
+		B *[]string
+	}
+	one := 1
+	data := []struct {
+		Raw  string
+		Want T
+	}{
+		{Raw: "a26141016142816178", Want: T{A: &one, B: &[]string{"x"}}},
+		{Raw: "a26141f66142f7", Want: T{}},
+		{Raw: "a1614101", Want: T{A: &one}},
+	}
+	for i, d := range data {
+		var got T
+		if err := decodeAndUnmarshal(d.Raw, &got); err != nil {
+			t.Errorf("%d: unexpected error: %s", i+1, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, d.Want) {
+			t.Errorf("%d: want %+v, got %+v", i+1, d.Want, got)
+		}
+	}
+	two := 2
+	got := T{A: &two}
+	if err := decodeAndUnmarshal("a16141f6", &got); err != nil || got.A != nil {
+		t.Errorf("null: want nil pointer, got %v (%v)", got.A, err)
+	}
+	if two != 2 {
+		t.Errorf("null: pointed value modified: %d", two)
+	}
+}
+
+func TestDecoderZeroCopy(t *testing.T) {
+	type T struct {
+		Bin  []byte     `cbor:"bin"`
+		Raw  RawMessage `cbor:"raw"`
+		Text string     `cbor:"text"`
+	}
+	decode := func(bs []byte, zerocopy, unsafe bool) T {
+		var v T
+		d := NewDecoderBytes(bs)
+		d.ZeroCopy(zerocopy)
+		d.UnsafeStrings(unsafe)
+		if err := d.Decode(&v); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		return v
+	}
+	input, _ := hex.DecodeString("a36362696e420102637261778203046474657874626162")
+	data := []struct {
+		ZeroCopy bool
+		Unsafe   bool
+		Want     T
+	}{
+		{Want: T{Bin: []byte{1, 2}, Raw: RawMessage{0x82, 3, 4}, Text: "ab"}},
+		{ZeroCopy: true, Want: T{Bin: []byte{0xff, 2}, Raw: RawMessage{0xff, 3, 4}, Text: "ab"}},
+		{Unsafe: true, Want: T{Bin: []byte{1, 2}, Raw: RawMessage{0x82, 3, 4}, Text: "xb"}},
+		{ZeroCopy: true, Unsafe: true, Want: T{Bin: []byte{0xff, 2}, Raw: RawMessage{0xff, 3, 4}, Text: "xb"}},
+	}
+	for i, d := range data {
+		bs := append([]byte(nil), input...)
+		v := decode(bs, d.ZeroCopy, d.Unsafe)
+		// modify the input to find out which fields share its memory
+		bs[6], bs[12], bs[21] = 0xff, 0xff, 'x'
+		if !reflect.DeepEqual(v, d.Want) {
+			t.Errorf("%d: want %+v, got %+v", i+1, d.Want, v)
+		}
+	}
+}
+
 func TestUnmarshalMap(t *testing.T) {
 	bs, err := hex.DecodeString("a4616101616202616304616405")
 	if err != nil {
@@ -227,6 +335,150 @@ func TestUnmarshalStruct(t *testing.T) {
 	})
 }
 
+func TestUnmarshalInvalidUTF8(t *testing.T) {
+	var s string
+	if err := decodeAndUnmarshal("6361ff62", &s); !errors.Is(err, ErrInvalidUTF8) {
+		t.Errorf("expected %v, got %v", ErrInvalidUTF8, err)
+	}
+	for _, v := range []interface{}{new(map[string][]string), new(Value)} {
+		var e *InvalidUTF8Error
+		if err := decodeAndUnmarshal("a1616182617861ff", v); !errors.As(err, &e) || e.Offset != 6 || e.Path != ".a[1]" {
+			t.Errorf("%T: want invalid UTF-8 at .a[1] (offset 6), got %v", v, err)
+		}
+	}
+	var e *InvalidUTF8Error
+	if err := decodeAndUnmarshal("a161ff01", new(struct{ A int })); !errors.As(err, &e) || e.Offset != 1 {
+		t.Errorf("field name: want invalid UTF-8 at offset 1, got %v", err)
+	}
+	d := NewDecoder(bytes.NewReader([]byte{0x63, 0x61, 0xff, 0x62}))
+	d.SetUTF8Policy(UTF8Replace)
+	if err := d.Decode(&s); err != nil {
+		t.Errorf("unmarshal fail: %v", err)
+		return
+	}
+	if want := "a\ufffdb"; s != want {
+		t.Errorf("want: %q, got: %q", want, s)
+	}
+}
+
+func TestUnmarshalUnknownFields(t *testing.T) {
+	type ab struct {
+		A int `cbor:"a"`
+	}
+	data := []struct {
+		Raw  string
+		Want ab
+	}{
+		{Raw: "a2616101616202", Want: ab{A: 1}},
+		{Raw: "a261620a616101", Want: ab{A: 1}},
+		{Raw: "a2616101616283a16178820203f663666f6f", Want: ab{A: 1}},
+		{Raw: "a261629f01bf6178820203ffff616101", Want: ab{A: 1}},
+		{Raw: "a261625f42010243030405ff616101", Want: ab{A: 1}},
+		{Raw: "a26162c11a514b67b0616101", Want: ab{A: 1}},
+		{Raw: "a26162fb41d452d9ec200000616101", Want: ab{A: 1}},
+		{Raw: "a26161010102", Want: ab{A: 1}},
+		{Raw: "a2820102a1f4f6616101", Want: ab{A: 1}},
+	}
+	t.Run("strict", func(t *testing.T) {
+		for i, d := range data {
+			var got ab
+			if err := decodeAndUnmarshal(d.Raw, &got); err == nil {
+				t.Errorf("%d: expected error for unknown field, got none", i+1)
+			}
+		}
+		var e *UnknownFieldError
+		if err := decodeAndUnmarshal("a26161010102", new(ab)); !errors.As(err, &e) || e.Path != "[1]" || e.Offset != 4 {
+			t.Errorf("want unknown field [1] at offset 4, got %v", err)
+		}
+	})
+	t.Run("ignore", func(t *testing.T) {
+		for i, d := range data {
+			bs, err := hex.DecodeString(d.Raw)
+			if err != nil {
+				t.Errorf("fail to decode string: %v", err)
+				return
+			}
+			var (
+				got ab
+				dec = NewDecoder(bytes.NewReader(bs))
+			)
+			dec.AllowUnknownFields(true)
+			if err := dec.Decode(&got); err != nil {
+				t.Errorf("%d: unmarshal fail: %v", i+1, err)
+				continue
+			}
+			if !reflect.DeepEqual(got, d.Want) {
+				t.Errorf("%d: values does not match: %+v != %+v", i+1, d.Want, got)
+			}
+		}
+		dec := NewDecoderBytes([]byte{0xa2, 0x01, 0x02, 0x01, 0x03})
+		dec.AllowUnknownFields(true)
+		var e *DuplicateKeyError
+		if err := dec.Decode(new(ab)); !errors.As(err, &e) || e.Offset != 3 {
+			t.Errorf("want duplicate key at offset 3, got %v", err)
+		}
+	})
+}
+
+func TestUnmarshalExtraFields(t *testing.T) {
+	type ab struct {
+		A     int                        `cbor:"a"`
+		Extra map[interface{}]RawMessage `cbor:",extra"`
+	}
+	var got ab
+	if err := decodeAndUnmarshal("a3616101616282020361639f01ff", &got); err != nil {
+		t.Errorf("unmarshal fail: %v", err)
+		return
+	}
+	want := ab{
+		A: 1,
+		Extra: map[interface{}]RawMessage{
+			"b": RawMessage{0x82, 0x02, 0x03},
+			"c": RawMessage{0x9f, 0x01, 0xff},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("values does not match: %+v != %+v", want, got)
+	}
+	delete(got.Extra, "c")
+	bs, err := Marshal(got)
+	if err != nil {
+		t.Errorf("marshal fail: %v", err)
+		return
+	}
+	if s := hex.EncodeToString(bs); s != "a26161016162820203" {
+		t.Errorf("round trip failed: want a26161016162820203, got %s", s)
+	}
+
+	// keys that are not text strings
+	got = ab{}
+	if err := decodeAndUnmarshal("a5616101010220f5f5f6f4f6", &got); err != nil {
+		t.Fatalf("unmarshal fail: %v", err)
+	}
+	want = ab{
+		A: 1,
+		Extra: map[interface{}]RawMessage{
+			uint64(1): RawMessage{0x02},
+			int64(-1): RawMessage{0xf5},
+			true:      RawMessage{0xf6},
+			false:     RawMessage{0xf6},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("values does not match: %+v != %+v", want, got)
+	}
+	// keys that can not be held are unknown fields
+	if err := decodeAndUnmarshal("a2616101820102f6", &got); err == nil {
+		t.Errorf("expected error for array key")
+	}
+	type named struct {
+		Extra map[string]RawMessage `cbor:",extra"`
+	}
+	if err := decodeAndUnmarshal("a10102", new(named)); err == nil {
+		t.Errorf("expected error for integer key in map of strings")
+	}
+}
+
 func TestUnmarshalFloat(t *testing.T) {
 	data := []struct {
 		Raw  string
@@ -275,3 +527,251 @@ func decodeAndUnmarshal(s string, v interface{}) error {
 	}
 	return Unmarshal(bs, v)
 }
+
+func TestUnmarshalScalarAllocs(t *testing.T) {
+	var (
+		u  uint64
+		i  int32
+		f  float64
+		g  float32
+		b  bool
+		p  *int
+		in = []struct {
+			Raw string
+			Dst interface{}
+		}{
+			{Raw: "1bffffffffffffffff", Dst: &u},
+			{Raw: "3903e7", Dst: &i},
+			{Raw: "c11a514b67b0", Dst: &u},
+			{Raw: "f93e00", Dst: &f},
+			{Raw: "fa47c35000", Dst: &g},
+			{Raw: "fb3ff199999999999a", Dst: &f},
+			{Raw: "f5", Dst: &b},
+			{Raw: "f6", Dst: &p},
+		}
+	)
+	for _, d := range in {
+		bs, _ := hex.DecodeString(d.Raw)
+		var err error
+		allocs := testing.AllocsPerRun(100, func() {
+			err = Unmarshal(bs, d.Dst)
+		})
+		if err != nil {
+			t.Errorf("%s: unmarshal fail: %s", d.Raw, err)
+		} else if allocs != 0 {
+			t.Errorf("%s: Unmarshal allocates %.0f times", d.Raw, allocs)
+		}
+	}
+	if u != 1363896240 || i != -1000 || f != 1.1 || g != 100000 || !b || p != nil {
+		t.Errorf("unexpected values: %d %d %f %f %t %v", u, i, f, g, b, p)
+	}
+}
+
+func TestUnmarshalErrors(t *testing.T) {
+	type item struct {
+		Name string `cbor:"name"`
+	}
+	type list struct {
+		Items []item `cbor:"items"`
+	}
+	data := []struct {
+		Input  string
+		Raw    string
+		Target func() interface{}
+		Depth  int
+		Length int
+		Want   error
+	}{
+		{
+			Input:  `{"items": [{"name": "a"}, {"name": 1}]}`,
+			Target: func() interface{} { return new(list) },
+			Want:   &UnmarshalTypeError{CBORType: "uint", GoType: reflect.TypeOf(""), Offset: 22, Path: ".items[1].name"},
+		},
+		{
+			Input:  `{"a": 1, "b": "x"}`,
+			Target: func() interface{} { return new(map[string]int) },
+			Want:   &UnmarshalTypeError{CBORType: "text", GoType: reflect.TypeOf(0), Offset: 6, Path: ".b"},
+		},
+		{
+			Input:  `{"items": [{"nick": "a"}]}`,
+			Target: func() interface{} { return new(list) },
+			Want:   &UnknownFieldError{Field: "nick", GoType: reflect.TypeOf(item{}), Offset: 9, Path: ".items[0].nick"},
+		},
+		{
+			Input:  `{"items": [], "items": []}`,
+			Target: func() interface{} { return new(list) },
+			Want:   &DuplicateKeyError{Key: "items", Offset: 8, Path: ".items"},
+		},
+		{
+			Input:  `[{"a": 1, "a": 2}]`,
+			Target: func() interface{} { return new(Value) },
+			Want:   &DuplicateKeyError{Key: `"a"`, Offset: 5, Path: `[0].a`},
+		},
+		{
+			Input:  `[[[1]]]`,
+			Target: func() interface{} { return new(Value) },
+			Depth:  2,
+			Want:   &MaxLimitError{Limit: "depth", Max: 2, Offset: 2, Path: "[0][0]"},
+		},
+		{
+			Input:  `{"items": [{"name": "abcdef"}]}`,
+			Target: func() interface{} { return new(list) },
+			Length: 5,
+			Want:   &MaxLimitError{Limit: "length", Max: 5, Offset: 14, Path: ".items[0].name"},
+		},
+		{
+			Input:  `[1, 2, 3]`,
+			Target: func() interface{} { return new([]int) },
+			Length: 2,
+			Want:   &MaxLimitError{Limit: "length", Max: 2, Offset: 0},
+		},
+		{
+			Raw:    "8201",
+			Target: func() interface{} { return new([]int) },
+			Want:   &SyntaxError{msg: "unexpected end of input", Offset: 2, err: io.ErrUnexpectedEOF},
+		},
+		{
+			Raw:    "a16141",
+			Target: func() interface{} { return new(struct{ A int }) },
+			Want:   &SyntaxError{msg: "unexpected end of input", Offset: 3, err: io.ErrUnexpectedEOF},
+		},
+		{
+			Raw:    "1a0102",
+			Target: func() interface{} { return new(uint) },
+			Want:   &SyntaxError{msg: "unexpected end of input", Offset: 3, err: io.ErrUnexpectedEOF},
+		},
+		{
+			Raw:    "9f6261",
+			Target: func() interface{} { return new(Value) },
+			Want:   &SyntaxError{msg: "unexpected end of input", Offset: 3, err: io.ErrUnexpectedEOF},
+		},
+		{
+			Raw:    "5f4301",
+			Target: func() interface{} { return new(Value) },
+			Want:   &SyntaxError{msg: "unexpected end of input", Offset: 3, err: io.ErrUnexpectedEOF},
+		},
+		{
+			Raw:    "5f41014302030405ff",
+			Target: func() interface{} { return new(Value) },
+			Length: 3,
+			Want:   &MaxLimitError{Limit: "length", Max: 3, Offset: 0},
+		},
+	}
+	for _, d := range data {
+		name := d.Raw
+		bs, _ := hex.DecodeString(d.Raw)
+		if d.Input != "" {
+			name, bs = d.Input, mustParse(t, d.Input)
+		}
+		for _, r := range []string{"bytes", "stream"} {
+			dec := NewDecoderBytes(bs)
+			if r == "stream" {
+				dec = NewDecoder(bytes.NewReader(bs))
+			}
+			dec.SetMaxDepth(d.Depth)
+			dec.SetMaxLength(d.Length)
+			err := dec.Decode(d.Target())
+			if err == nil || err == io.EOF {
+				t.Errorf("%s (%s): expected error, got %v", name, r, err)
+				continue
+			}
+			got := reflect.New(reflect.TypeOf(d.Want))
+			if !errors.As(err, got.Interface()) {
+				t.Errorf("%s (%s): unexpected error %T: %s", name, r, err, err)
+				continue
+			}
+			if !reflect.DeepEqual(got.Elem().Interface(), d.Want) {
+				t.Errorf("%s (%s): want %#v, got %#v", name, r, d.Want, got.Elem().Interface())
+			}
+		}
+	}
+}
+
+func TestUnmarshalHugeChunk(t *testing.T) {
+	bs, _ := hex.DecodeString("5f5b7fffffffffffffff")
+	for _, r := range []string{"bytes", "stream"} {
+		dec := NewDecoderBytes(bs)
+		if r == "stream" {
+			dec = NewDecoder(bytes.NewReader(bs))
+		}
+		var v Value
+		if err := dec.Decode(&v); err == nil {
+			t.Errorf("%s: expected error, got %s", r, v)
+		}
+	}
+}
+
+func TestUnmarshalSyntaxError(t *testing.T) {
+	data := []struct {
+		Raw    string
+		Offset int64
+	}{
+		{Raw: "ff", Offset: 0},
+		{Raw: "821c01", Offset: 1},
+		{Raw: "a161617f4161ff", Offset: 4},
+		{Raw: "9f1f", Offset: 1},
+		{Raw: "82f810", Offset: 1},
+		{Raw: "9ff818ff", Offset: 1},
+	}
+	for _, d := range data {
+		var (
+			bs, _ = hex.DecodeString(d.Raw)
+			v     interface{}
+			err   error
+			se    *SyntaxError
+		)
+		switch d.Raw[:2] {
+		case "a1":
+			v = new(map[string]string)
+		case "9f":
+			v = new(Value)
+		default:
+			v = new([]int)
+		}
+		if err = Unmarshal(bs, v); !errors.As(err, &se) {
+			t.Errorf("%s: expected syntax error, got %v", d.Raw, err)
+			continue
+		}
+		if se.Offset != d.Offset {
+			t.Errorf("%s: want offset %d, got %d", d.Raw, d.Offset, se.Offset)
+		}
+	}
+}
+
+func TestUnmarshalDeep(t *testing.T) {
+	bs := append(bytes.Repeat([]byte{0x81}, 1000000), 0)
+	type nested []nested
+	var (
+		v  Value
+		x  nested
+		me *MaxLimitError
+	)
+	if err := Unmarshal(bs, &v); !errors.As(err, &me) || me.Offset != defaultMaxDepth {
+		t.Errorf("value: expected depth limit error, got %v", err)
+	}
+	if err := Unmarshal(bs, &x); !errors.As(err, &me) {
+		t.Errorf("slice: expected depth limit error, got %v", err)
+	}
+	if _, err := Equal(bs, bs); !errors.As(err, &me) {
+		t.Errorf("equal: expected depth limit error, got %v", err)
+	}
+	bs = append(bytes.Repeat([]byte{0x81}, defaultMaxDepth), 0)
+	if err := Unmarshal(bs, &v); err != nil {
+		t.Errorf("value: unexpected error at maximum depth: %s", err)
+	}
+}
+
+func TestDecoderEOF(t *testing.T) {
+	bs, _ := hex.DecodeString("0102")
+	dec := NewDecoder(bytes.NewReader(bs))
+	for i := 0; i < 2; i++ {
+		var v int
+		if err := dec.Decode(&v); err != nil {
+			t.Fatalf("%d: unexpected error: %s", i, err)
+		}
+	}
+	var v int
+	if err := dec.Decode(&v); err != io.EOF {
+		t.Errorf("want io.EOF, got %v", err)
+	}
+}
@@ -0,0 +1,409 @@
+package cbor
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"time"
+	"unicode/utf8"
+)
+
+// Valid reports whether bs holds exactly one well-formed and valid CBOR data
+// item. The returned error is a *SyntaxError giving the offset of the first
+// problem found. Items nested deeper than the default depth of a Decoder are
+// rejected.
+func Valid(bs []byte) error {
+	r := bytes.NewReader(bs)
+	v := validator{r: r, maxDepth: defaultMaxDepth}
+	if err := v.validate(); err != nil {
+		return err
+	}
+	if r.Len() > 0 {
+		return v.errorf(v.off, "%d trailing bytes after item", r.Len())
+	}
+	return nil
+}
+
+// Validate reads the next data item from the input and checks that it is
+// well-formed and valid. The offset of the returned *SyntaxError is relative
+// to the first byte of the item. The maximum depth of the Decoder applies.
+func (d *Decoder) Validate() error {
+	v := validator{r: d.r, maxDepth: d.maxDepth}
+	return v.validate()
+}
+
+type validator struct {
+	r   reader
+	off int64
+	// end is the offset following the encoded data item of tag 24 being
+	// validated or 0.
+	end int64
+
+	depth    int
+	maxDepth int
+}
+
+func (v *validator) validate() error {
+	_, err := v.item()
+	return err
+}
+
+// header reads the next header. Its syntax errors give the offset of the
+// header in the input.
+func (v *validator) header() (Header, int64, error) {
+	start := v.off
+	h, err := ReadHeader(v)
+	if err != nil {
+		err = v.truncated(shiftError(err, start))
+	}
+	return h, start, err
+}
+
+func (v *validator) item() (Header, error) {
+	h, start, err := v.header()
+	if err != nil {
+		return h, err
+	}
+	if h.IsBreak() {
+		return h, v.errorf(start, "unexpected break")
+	}
+	return h, v.next(h, start)
+}
+
+// next validates the rest of the item of header h starting at start. The
+// nesting of arrays, maps and tags is limited so that the stack can not be
+// exhausted.
+func (v *validator) next(h Header, start int64) error {
+	nested := h.Major == Array || h.Major == Map || h.Major == Tag
+	if nested {
+		if v.depth++; v.maxDepth > 0 && v.depth > v.maxDepth {
+			e := &MaxLimitError{Limit: "depth", Max: v.maxDepth, Offset: start}
+			return &SyntaxError{msg: fmt.Sprintf("max depth %d exceeded", v.maxDepth), Offset: start, err: e}
+		}
+	}
+	err := v.content(h, start)
+	if nested {
+		v.depth--
+	}
+	return err
+}
+
+func (v *validator) content(h Header, start int64) error {
+	if h.Indefinite() {
+		if h.Major == Bin || h.Major == String {
+			return v.chunks(h.Major)
+		}
+		return v.indefinite(h.Major)
+	}
+	var err error
+	switch h.Major {
+	case Bin, String:
+		err = v.payload(h.Arg, h.Major == String)
+	case Array, Map:
+		for i := uint64(0); i < h.Arg && err == nil; i++ {
+			if _, err = v.item(); err == nil && h.Major == Map {
+				_, err = v.item()
+			}
+		}
+	case Tag:
+		err = v.tagged(h.Arg, start)
+	case Other:
+		if h.Info == Simple && h.Arg < 32 {
+			err = v.errorf(start, "invalid simple value %d", h.Arg)
+		}
+	}
+	return err
+}
+
+func (v *validator) chunks(m byte) error {
+	for {
+		h, start, err := v.chunk(m)
+		if err != nil || h.IsBreak() {
+			return err
+		}
+		if err := v.next(h, start); err != nil {
+			return err
+		}
+	}
+}
+
+// chunk reads the header of the next chunk of an indefinite length string
+// of major type m or its break code.
+func (v *validator) chunk(m byte) (Header, int64, error) {
+	h, start, err := v.header()
+	if err == nil && !h.IsBreak() && (h.Major != m || h.Indefinite()) {
+		err = v.errorf(start, "invalid chunk in indefinite length string")
+	}
+	return h, start, err
+}
+
+// join reads the chunks of an indefinite length string of major type m and
+// returns their payloads. It fails with the error of tooLong if they are
+// longer than max bytes.
+func (v *validator) join(m byte, max uint64, tooLong func() error) ([]byte, error) {
+	var bs []byte
+	for {
+		h, _, err := v.chunk(m)
+		if err != nil || h.IsBreak() {
+			return bs, err
+		}
+		if h.Arg > max-uint64(len(bs)) {
+			return nil, tooLong()
+		}
+		n := len(bs)
+		bs = append(bs, make([]byte, h.Arg)...)
+		if err := v.readFull(bs[n:]); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (v *validator) indefinite(m byte) error {
+	for i := 0; ; i++ {
+		h, start, err := v.header()
+		if err != nil {
+			return err
+		}
+		if h.IsBreak() {
+			if m == Map && i%2 == 1 {
+				return v.errorf(start, "missing value in indefinite length map")
+			}
+			return nil
+		}
+		if err := v.next(h, start); err != nil {
+			return err
+		}
+	}
+}
+
+// tagged validates the content of a tag starting at start. The errors about
+// the content give the offset of the tag.
+func (v *validator) tagged(tag uint64, start int64) error {
+	switch tag {
+	case TagRFC3339:
+		return v.datetime(start)
+	case TagDecimal, TagBigFloat:
+		return v.fraction(start)
+	case TagItem:
+		return v.embedded(start)
+	}
+	h, err := v.item()
+	if err != nil {
+		return err
+	}
+	var ok bool
+	switch m := h.Major; tag {
+	default:
+		ok = true
+	case TagUnix:
+		ok = m == Uint || m == Int || h.IsFloat()
+	case TagBigPos, TagBigNeg:
+		ok = m == Bin
+	case TagURI, TagBase64URL, TagBase64, TagRegex, TagMIME:
+		ok = m == String
+	}
+	if !ok {
+		return v.errorf(start, "invalid content for tag %d", tag)
+	}
+	return nil
+}
+
+func (v *validator) datetime(start int64) error {
+	h, _, err := v.header()
+	if err != nil {
+		return err
+	}
+	if h.Major != String {
+		return v.errorf(start, "invalid content for tag %d", TagRFC3339)
+	}
+	invalid := func() error {
+		return v.errorf(start, "invalid date/time string")
+	}
+	var bs []byte
+	if h.Indefinite() {
+		if bs, err = v.join(String, 64, invalid); err != nil {
+			return err
+		}
+	} else {
+		if h.Arg > 64 {
+			return invalid()
+		}
+		bs = make([]byte, h.Arg)
+		if err := v.readFull(bs); err != nil {
+			return err
+		}
+	}
+	if _, err := time.Parse(time.RFC3339, string(bs)); err != nil {
+		return invalid()
+	}
+	return nil
+}
+
+func (v *validator) fraction(start int64) error {
+	h, _, err := v.header()
+	if err != nil {
+		return err
+	}
+	if h.Major != Array || h.Indefinite() || h.Arg != 2 {
+		return v.errorf(start, "array of two items expected")
+	}
+	if h, err = v.item(); err != nil {
+		return err
+	}
+	if m := h.Major; m != Uint && m != Int {
+		return v.errorf(start, "invalid exponent")
+	}
+	if h, err = v.item(); err != nil {
+		return err
+	}
+	if m := h.Major; m != Uint && m != Int && !(m == Tag && (h.Arg == TagBigPos || h.Arg == TagBigNeg)) {
+		return v.errorf(start, "invalid mantissa")
+	}
+	return nil
+}
+
+// embedded checks that the byte string of tag 24 holds exactly one data item.
+// The item of a definite length string is validated in place, the reads being
+// limited to the string, so that its errors give offsets in the input.
+func (v *validator) embedded(start int64) error {
+	h, _, err := v.header()
+	if err != nil {
+		return err
+	}
+	if h.Major != Bin || h.Arg == 0 && !h.Indefinite() {
+		return v.errorf(start, "invalid content for tag %d", TagItem)
+	}
+	if h.Indefinite() {
+		bs, err := v.join(Bin, uint64(maxInt), func() error { return ErrTooLarge })
+		if err != nil {
+			return err
+		}
+		r := bytes.NewReader(bs)
+		w := validator{r: r, depth: v.depth, maxDepth: v.maxDepth}
+		if err := w.validate(); err != nil {
+			return &SyntaxError{msg: "invalid encoded data item", Offset: start, err: err}
+		}
+		if r.Len() > 0 {
+			return v.errorf(start, "%d trailing bytes after encoded data item", r.Len())
+		}
+		return nil
+	}
+	end, outer := v.off+int64(h.Arg), v.end
+	if h.Arg > uint64(math.MaxInt64-v.off) || (outer > 0 && end > outer) {
+		// the string itself is truncated
+		end = outer
+	}
+	v.end = end
+	_, err = v.item()
+	v.end = outer
+	if err != nil {
+		return err
+	}
+	if v.off < end {
+		return v.errorf(start, "%d trailing bytes after encoded data item", end-v.off)
+	}
+	return nil
+}
+
+// payload reads the n bytes of a string. The bytes of a byte string are
+// discarded and the ones of a text string are checked for valid UTF-8
+// without keeping the full string in memory.
+func (v *validator) payload(n uint64, text bool) error {
+	if !text {
+		return v.truncated(discard(v, n))
+	}
+	var (
+		buf  [512]byte
+		keep int
+	)
+	for n > 0 {
+		z := len(buf) - keep
+		if uint64(z) > n {
+			z = int(n)
+		}
+		if err := v.readFull(buf[keep : keep+z]); err != nil {
+			return err
+		}
+		n -= uint64(z)
+		data, end := buf[:keep+z], keep+z
+		if n > 0 {
+			end = fullRunes(data)
+		}
+		if i := invalidUTF8(data[:end]); i >= 0 {
+			return v.errorf(v.off-int64(len(data)-i), "invalid UTF-8 in text string")
+		}
+		keep = copy(buf[:], data[end:])
+	}
+	return nil
+}
+
+// ReadByte and Read do not read past the end of the encoded data item being
+// validated if any.
+func (v *validator) ReadByte() (byte, error) {
+	if v.end > 0 && v.off >= v.end {
+		return 0, io.EOF
+	}
+	b, err := v.r.ReadByte()
+	if err == nil {
+		v.off++
+	}
+	return b, err
+}
+
+func (v *validator) Read(bs []byte) (int, error) {
+	if v.end > 0 {
+		if v.off >= v.end {
+			return 0, io.EOF
+		}
+		if z := v.end - v.off; int64(len(bs)) > z {
+			bs = bs[:z]
+		}
+	}
+	n, err := v.r.Read(bs)
+	v.off += int64(n)
+	return n, err
+}
+
+func (v *validator) readFull(bs []byte) error {
+	_, err := io.ReadFull(v, bs)
+	return v.truncated(err)
+}
+
+func (v *validator) truncated(err error) error {
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return v.errorf(v.off, "unexpected end of input")
+	}
+	return err
+}
+
+func (v *validator) errorf(off int64, pattern string, args ...interface{}) error {
+	return &SyntaxError{msg: fmt.Sprintf(pattern, args...), Offset: off}
+}
+
+// fullRunes returns the length of the prefix of bs that does not end with an
+// incomplete UTF-8 sequence.
+func fullRunes(bs []byte) int {
+	for i := len(bs) - 1; i >= 0 && i >= len(bs)-utf8.UTFMax; i-- {
+		if utf8.RuneStart(bs[i]) {
+			if !utf8.FullRune(bs[i:]) {
+				return i
+			}
+			break
+		}
+	}
+	return len(bs)
+}
+
+// invalidUTF8 returns the index of the first invalid UTF-8 sequence in bs or
+// -1 if bs is valid.
+func invalidUTF8(bs []byte) int {
+	for i := 0; i < len(bs); {
+		r, z := utf8.DecodeRune(bs[i:])
+		if r == utf8.RuneError && z <= 1 {
+			return i
+		}
+		i += z
+	}
+	return -1
+}
@@ -0,0 +1,133 @@
+package cbor
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"testing"
+)
+
+func TestValid(t *testing.T) {
+	data := []string{
+		"00",
+		"1b0000000000000001",
+		"3903e7",
+		"4401020304",
+		"5f42010243030405ff",
+		"6449455446",
+		"7f657374726561646d696e67ff",
+		"63e6b0b4",
+		"83010203",
+		"9f018202039f0405ffff",
+		"a26161016162820203",
+		"bf61610161629f0203ffff",
+		"c074323031332d30332d32315432303a30343a30305a",
+		"c07f6a323031332d30332d32316a5432303a30343a30305aff",
+		"c11a514b67b0",
+		"c1fb41d452d9ec200000",
+		"c249010000000000000000",
+		"c4822020",
+		"c5822003",
+		"c482203903e7",
+		"c48221c24101",
+		"d82076687474703a2f2f7777772e6578616d706c652e636f6d",
+		"d818456449455446",
+		"d8185f42644943455446ff",
+		"d81844d8184100",
+		"82d8184101d81844d8184100",
+		"f0",
+		"f8ff",
+		"f93c00",
+		"fa47c35000",
+		"fb3ff199999999999a",
+	}
+	for i, d := range data {
+		bs, err := hex.DecodeString(d)
+		if err != nil {
+			t.Errorf("%d: fail to decode hex string: %s (%s)", i+1, err, d)
+			continue
+		}
+		if err := Valid(bs); err != nil {
+			t.Errorf("%d: %s should be valid: %s", i+1, d, err)
+		}
+	}
+}
+
+func TestInvalid(t *testing.T) {
+	data := []struct {
+		Raw    string
+		Offset int64
+	}{
+		{Raw: "", Offset: 0},
+		{Raw: "18", Offset: 1},
+		{Raw: "1901", Offset: 2},
+		{Raw: "1c", Offset: 0},
+		{Raw: "831d0102", Offset: 1},
+		{Raw: "fe", Offset: 0},
+		{Raw: "1f", Offset: 0},
+		{Raw: "3f", Offset: 0},
+		{Raw: "ff", Offset: 0},
+		{Raw: "8201ff", Offset: 2},
+		{Raw: "440102", Offset: 3},
+		{Raw: "5f4101610201ff", Offset: 3},
+		{Raw: "5f5f4101ffff", Offset: 1},
+		{Raw: "7f4161ff", Offset: 1},
+		{Raw: "9f0102", Offset: 3},
+		{Raw: "bf010203ff", Offset: 4},
+		{Raw: "bf01ff", Offset: 2},
+		{Raw: "62c328", Offset: 1},
+		{Raw: "6461ff6262", Offset: 2},
+		{Raw: "7f61c361a9ff", Offset: 2},
+		{Raw: "f800", Offset: 0},
+		{Raw: "f81f", Offset: 0},
+		{Raw: "0000", Offset: 1},
+		{Raw: "c001", Offset: 0},
+		{Raw: "c06474657374", Offset: 0},
+		{Raw: "c07f6378797aff", Offset: 0},
+		{Raw: "c07f6378797a01ff", Offset: 6},
+		{Raw: "c16161", Offset: 0},
+		{Raw: "c2f5", Offset: 0},
+		{Raw: "c48101", Offset: 0},
+		{Raw: "c4826161f5", Offset: 0},
+		{Raw: "d8204101", Offset: 0},
+		{Raw: "d818420102", Offset: 0},
+		{Raw: "d81840", Offset: 0},
+		{Raw: "d8184118", Offset: 4},
+		{Raw: "d818421c00", Offset: 3},
+		{Raw: "82d81841820101", Offset: 5},
+		{Raw: "d8185f41014102ff", Offset: 0},
+		{Raw: "d8185f41ffff", Offset: 0},
+	}
+	for i, d := range data {
+		bs, err := hex.DecodeString(d.Raw)
+		if err != nil {
+			t.Errorf("%d: fail to decode hex string: %s (%s)", i+1, err, d.Raw)
+			continue
+		}
+		err = Valid(bs)
+		if err == nil {
+			t.Errorf("%d: %s should be invalid", i+1, d.Raw)
+			continue
+		}
+		var e *SyntaxError
+		if !errors.As(err, &e) {
+			t.Errorf("%d: %s: unexpected error type %T", i+1, d.Raw, err)
+			continue
+		}
+		if e.Offset != d.Offset {
+			t.Errorf("%d: %s: offset mismatched: want %d, got %d (%s)", i+1, d.Raw, d.Offset, e.Offset, err)
+		}
+	}
+}
+
+func TestValidDeep(t *testing.T) {
+	bs := append(bytes.Repeat([]byte{0x81}, 5000000), 0)
+	var me *MaxLimitError
+	if err := Valid(bs); !errors.As(err, &me) || me.Offset != defaultMaxDepth {
+		t.Errorf("expected depth limit error, got %v", err)
+	}
+	bs = append(bytes.Repeat([]byte{0x81}, defaultMaxDepth), 0)
+	if err := Valid(bs); err != nil {
+		t.Errorf("unexpected error at maximum depth: %s", err)
+	}
+}
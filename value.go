@@ -0,0 +1,669 @@
+package cbor
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
+	"unicode/utf8"
+)
+
+// Kind is the type of data item held by a Value.
+type Kind int
+
+const (
+	KindInvalid Kind = iota
+	KindUint
+	KindInt
+	KindBytes
+	KindText
+	KindArray
+	KindMap
+	KindTag
+	KindBool
+	KindNull
+	KindUndefined
+	KindSimple
+	KindFloat
+)
+
+func (k Kind) String() string {
+	switch k {
+	case KindUint:
+		return "uint"
+	case KindInt:
+		return "int"
+	case KindBytes:
+		return "bytes"
+	case KindText:
+		return "text"
+	case KindArray:
+		return "array"
+	case KindMap:
+		return "map"
+	case KindTag:
+		return "tag"
+	case KindBool:
+		return "bool"
+	case KindNull:
+		return "null"
+	case KindUndefined:
+		return "undefined"
+	case KindSimple:
+		return "simple"
+	case KindFloat:
+		return "float"
+	default:
+		return "invalid"
+	}
+}
+
+// Value holds any CBOR data item. It can be used with Marshal and Unmarshal
+// to inspect and rewrite documents without a matching Go type.
+//
+// The zero Value is invalid and is encoded as undefined.
+type Value struct {
+	kind  Kind
+	num   uint64
+	float float64
+	bytes []byte
+	items []Value
+	dict  *OrderedMap
+	enc   *encoding
+}
+
+var valueType = reflect.TypeOf(Value{})
+
+func NewUint(v uint64) Value {
+	return Value{kind: KindUint, num: v}
+}
+
+func NewInt(v int64) Value {
+	if v >= 0 {
+		return NewUint(uint64(v))
+	}
+	return Value{kind: KindInt, num: uint64(-1 - v)}
+}
+
+func NewFloat(v float64) Value {
+	return Value{kind: KindFloat, float: v}
+}
+
+func NewText(v string) Value {
+	return Value{kind: KindText, bytes: []byte(v)}
+}
+
+func NewBytes(v []byte) Value {
+	return Value{kind: KindBytes, bytes: v}
+}
+
+func NewBool(v bool) Value {
+	var n uint64
+	if v {
+		n = 1
+	}
+	return Value{kind: KindBool, num: n}
+}
+
+func NewNull() Value {
+	return Value{kind: KindNull}
+}
+
+func NewUndefined() Value {
+	return Value{kind: KindUndefined}
+}
+
+func NewSimple(v byte) Value {
+	return Value{kind: KindSimple, num: uint64(v)}
+}
+
+func NewTag(tag uint64, v Value) Value {
+	return Value{kind: KindTag, num: tag, items: []Value{v}}
+}
+
+func NewArray(vs ...Value) Value {
+	return Value{kind: KindArray, items: vs}
+}
+
+func NewMap() Value {
+	return Value{kind: KindMap, dict: NewOrderedMap()}
+}
+
+func (v Value) Kind() Kind {
+	return v.kind
+}
+
+func (v Value) IsValid() bool {
+	return v.kind != KindInvalid
+}
+
+func (v Value) Uint() (uint64, error) {
+	if v.kind != KindUint {
+		return 0, v.expected(KindUint)
+	}
+	return v.num, nil
+}
+
+// Int returns the value of an unsigned or negative integer. It fails with
+// ErrOutOfRange if the integer does not fit an int64.
+func (v Value) Int() (int64, error) {
+	if v.kind != KindUint && v.kind != KindInt {
+		return 0, v.expected(KindInt)
+	}
+	if v.num > math.MaxInt64 {
+		return 0, ErrOutOfRange
+	}
+	if v.kind == KindInt {
+		return -1 - int64(v.num), nil
+	}
+	return int64(v.num), nil
+}
+
+func (v Value) Float() (float64, error) {
+	if v.kind != KindFloat {
+		return 0, v.expected(KindFloat)
+	}
+	return v.float, nil
+}
+
+func (v Value) Bool() (bool, error) {
+	if v.kind != KindBool {
+		return false, v.expected(KindBool)
+	}
+	return v.num == 1, nil
+}
+
+func (v Value) Text() (string, error) {
+	if v.kind != KindText {
+		return "", v.expected(KindText)
+	}
+	return string(v.bytes), nil
+}
+
+func (v Value) Bytes() ([]byte, error) {
+	if v.kind != KindBytes {
+		return nil, v.expected(KindBytes)
+	}
+	return v.bytes, nil
+}
+
+func (v Value) Simple() (byte, error) {
+	if v.kind != KindSimple {
+		return 0, v.expected(KindSimple)
+	}
+	return byte(v.num), nil
+}
+
+// Tag returns the number of a tag and its content.
+func (v Value) Tag() (uint64, Value, error) {
+	if v.kind != KindTag {
+		return 0, Value{}, v.expected(KindTag)
+	}
+	return v.num, v.items[0], nil
+}
+
+// Len returns the number of elements of an array, of entries of a map or of
+// bytes of a string. It returns 0 for the other kinds.
+func (v Value) Len() int {
+	switch v.kind {
+	case KindArray:
+		return len(v.items)
+	case KindMap:
+		return v.dict.Len()
+	case KindBytes, KindText:
+		return len(v.bytes)
+	default:
+		return 0
+	}
+}
+
+// Index returns the element at index i of an array.
+func (v Value) Index(i int) (Value, error) {
+	if v.kind != KindArray {
+		return Value{}, v.expected(KindArray)
+	}
+	if i < 0 || i >= len(v.items) {
+		return Value{}, ErrOutOfRange
+	}
+	return v.items[i], nil
+}
+
+// Map returns the entries of a map. Maps share their entries with the
+// copies of the Value they come from.
+func (v Value) Map() (*OrderedMap, error) {
+	if v.kind != KindMap {
+		return nil, v.expected(KindMap)
+	}
+	return v.dict, nil
+}
+
+// Keys returns the keys of a map in the order they were decoded or set.
+func (v Value) Keys() []Value {
+	if v.kind != KindMap {
+		return nil
+	}
+	return v.dict.Keys()
+}
+
+// Get returns the value of a map entry. The key can be a Value or any Go
+// value accepted by Marshal.
+func (v Value) Get(key interface{}) (Value, bool) {
+	if v.kind != KindMap {
+		return Value{}, false
+	}
+	return v.dict.Get(key)
+}
+
+// Append adds elements at the end of an array. The elements can be Value or
+// any Go value accepted by Marshal.
+func (v *Value) Append(vs ...interface{}) error {
+	if v.kind != KindArray {
+		return v.expected(KindArray)
+	}
+	for _, x := range vs {
+		e, err := toValue(x)
+		if err != nil {
+			return err
+		}
+		v.items = append(v.items, e)
+	}
+	return nil
+}
+
+// Set sets the value of the entry of a map with the given key. A new entry
+// is added after the existing ones if the map has no such key.
+func (v Value) Set(key, val interface{}) error {
+	if v.kind != KindMap {
+		return v.expected(KindMap)
+	}
+	return v.dict.Set(key, val)
+}
+
+// String returns the diagnostic notation of v.
+func (v Value) String() string {
+	var str strings.Builder
+	if err := Debug(&str, v.append(nil)); err != nil {
+		return fmt.Sprintf("<invalid: %s>", err)
+	}
+	return strings.TrimSpace(str.String())
+}
+
+func (v Value) expected(k Kind) error {
+	return fmt.Errorf("cbor: expected %s, got %s", k, v.kind)
+}
+
+// encoding records how an item was encoded when it was decoded by a Decoder
+// that preserves the encoding.
+type encoding struct {
+	info   byte
+	bits   uint64
+	chunks []chunkInfo
+}
+
+// chunkInfo is the additional information and the size of a chunk of an
+// indefinite length string.
+type chunkInfo struct {
+	info byte
+	size uint64
+}
+
+type encodeMode int
+
+const (
+	// encodeExact writes items with their preserved encoding if any.
+	encodeExact encodeMode = iota
+	// encodeDeterministic writes items in their preferred serialization
+	// with the entries of maps sorted by their encoded keys (RFC 8949
+	// section 4.2.1).
+	encodeDeterministic
+)
+
+// append appends the encoding of v to bs. Items decoded with their encoding
+// preserved are written as they were read if they were not modified. The
+// other items are written in their preferred serialization: shortest
+// arguments and floats with the smallest width that keeps their value.
+func (v Value) append(bs []byte) []byte {
+	return v.encode(bs, encodeExact)
+}
+
+func (v Value) encode(bs []byte, mode encodeMode) []byte {
+	switch v.kind {
+	case KindUint:
+		return appendHeader(bs, Uint, v.info(v.num, mode), v.num)
+	case KindInt:
+		return appendHeader(bs, Int, v.info(v.num, mode), v.num)
+	case KindBytes, KindText:
+		m := byte(Bin)
+		if v.kind == KindText {
+			m = String
+		}
+		if mode == encodeExact && v.enc != nil && v.enc.info == Indefinite {
+			if bs, ok := v.encodeChunks(bs, m); ok {
+				return bs
+			}
+		}
+		z := uint64(len(v.bytes))
+		return append(appendHeader(bs, m, v.info(z, mode), z), v.bytes...)
+	case KindArray:
+		z := uint64(len(v.items))
+		if mode == encodeExact && v.enc != nil && v.enc.info == Indefinite {
+			bs = append(bs, Array|Indefinite)
+		} else {
+			bs = appendHeader(bs, Array, v.info(z, mode), z)
+		}
+		for _, e := range v.items {
+			bs = e.encode(bs, mode)
+		}
+		if mode == encodeExact && v.enc != nil && v.enc.info == Indefinite {
+			bs = append(bs, Break)
+		}
+		return bs
+	case KindMap:
+		return v.dict.encode(bs, mode)
+	case KindTag:
+		bs = appendHeader(bs, Tag, v.info(v.num, mode), v.num)
+		return v.items[0].encode(bs, mode)
+	case KindBool:
+		return append(bs, (Other|False)+byte(v.num))
+	case KindNull:
+		return append(bs, Other|Nil)
+	case KindSimple:
+		return appendHeader(bs, Other, v.info(v.num, mode), v.num)
+	case KindFloat:
+		if mode == encodeExact && v.enc != nil {
+			return appendHeader(bs, Other, v.enc.info, v.enc.bits)
+		}
+		return appendFloat(bs, v.float, floatSize(v.float))
+	default:
+		return append(bs, Other|Undefined)
+	}
+}
+
+func (v Value) encodeChunks(bs []byte, m byte) ([]byte, bool) {
+	var z uint64
+	for _, c := range v.enc.chunks {
+		z += c.size
+	}
+	if z != uint64(len(v.bytes)) {
+		return bs, false
+	}
+	bs = append(bs, m|Indefinite)
+	for i, off := 0, uint64(0); i < len(v.enc.chunks); i++ {
+		c := v.enc.chunks[i]
+		bs = appendHeader(bs, m, c.info, c.size)
+		bs = append(bs, v.bytes[off:off+c.size]...)
+		off += c.size
+	}
+	return append(bs, Break), true
+}
+
+// info returns the additional information to use for the argument n: the
+// preserved one if it is still suitable, otherwise the shortest one.
+func (v Value) info(n uint64, mode encodeMode) byte {
+	return preferredInfo(v.enc, n, mode)
+}
+
+func preferredInfo(enc *encoding, n uint64, mode encodeMode) byte {
+	if mode == encodeExact && enc != nil && enc.info != Indefinite && fits(n, enc.info) {
+		return enc.info
+	}
+	return infoOf(n)
+}
+
+// toValue converts x to a Value by encoding it.
+func toValue(x interface{}) (Value, error) {
+	switch x := x.(type) {
+	case Value:
+		return x, nil
+	case *Value:
+		return *x, nil
+	}
+	bs, err := Marshal(x)
+	if err != nil {
+		return Value{}, err
+	}
+	var v Value
+	return v, Unmarshal(bs, &v)
+}
+
+func decodeValue(d *Decoder) (Value, error) {
+	h, off, err := d.header()
+	if err != nil {
+		return Value{}, err
+	}
+	return decodeItem(d, h, off)
+}
+
+// decodeItem decodes the item of header h starting at off.
+func decodeItem(d *Decoder, h Header, off int64) (Value, error) {
+	if h.IsBreak() {
+		return Value{}, &SyntaxError{msg: "unexpected break", Offset: off}
+	}
+	m, arg := h.Major, h.Arg
+	if m == Array || m == Map || m == Tag {
+		if err := d.nest(off); err != nil {
+			return Value{}, err
+		}
+		defer func() {
+			d.depth--
+		}()
+	}
+	if h.Indefinite() {
+		return decodeIndefinite(d, m, off)
+	}
+	if m == Bin || m == String || m == Array || m == Map {
+		if err := d.checkLength(arg, off); err != nil {
+			return Value{}, err
+		}
+	}
+	var v Value
+	switch m {
+	case Uint:
+		v = NewUint(arg)
+	case Int:
+		v = Value{kind: KindInt, num: arg}
+	case Bin, String:
+		bs, _, err := d.read(arg, d.zerocopy)
+		if err != nil {
+			return Value{}, err
+		}
+		if v, err = decodeText(d, m, bs, off); err != nil {
+			return v, err
+		}
+	case Array, Map:
+		v = Value{kind: KindArray}
+		if m == Map {
+			v = NewMap()
+		}
+		for i := uint64(0); i < arg; i++ {
+			h, off, err := d.header()
+			if err != nil {
+				return v, err
+			}
+			if err := decodeEntry(d, &v, h, off); err != nil {
+				return v, err
+			}
+		}
+	case Tag:
+		e, err := decodeValue(d)
+		if err != nil {
+			return v, err
+		}
+		v = NewTag(arg, e)
+	default:
+		v = decodeSimple(h.Info, arg)
+	}
+	if d.preserve {
+		v.preserve(&encoding{info: h.Info, bits: arg})
+	}
+	return v, nil
+}
+
+// decodeIndefinite decodes the indefinite length item of major type m
+// starting at off.
+func decodeIndefinite(d *Decoder, m byte, off int64) (Value, error) {
+	var (
+		v      Value
+		bs     []byte
+		chunks []chunkInfo
+	)
+	switch m {
+	case Bin, String:
+	case Array:
+		v.kind = KindArray
+	case Map:
+		v = NewMap()
+	}
+	for n := uint64(1); ; n++ {
+		h, hoff, err := d.header()
+		if err != nil {
+			return v, err
+		}
+		if h.IsBreak() {
+			break
+		}
+		if v.kind == KindArray || v.kind == KindMap {
+			if err := d.checkLength(n, off); err != nil {
+				return v, err
+			}
+			if err := decodeEntry(d, &v, h, hoff); err != nil {
+				return v, err
+			}
+			continue
+		}
+		if h.Major != m || h.Indefinite() {
+			return v, &SyntaxError{msg: "invalid chunk in indefinite length string", Offset: hoff}
+		}
+		if h.Arg > uint64(maxInt-len(bs)) {
+			return v, ErrTooLarge
+		}
+		if err := d.checkLength(uint64(len(bs))+h.Arg, off); err != nil {
+			return v, err
+		}
+		// the chunk can be shared with the input since it is copied to bs
+		chunk, _, err := d.read(h.Arg, true)
+		if err != nil {
+			return v, err
+		}
+		bs = append(bs, chunk...)
+		chunks = append(chunks, chunkInfo{info: h.Info, size: h.Arg})
+	}
+	if v.kind == KindInvalid {
+		var err error
+		if v, err = decodeText(d, m, bs, off); err != nil {
+			return v, err
+		}
+	}
+	if d.preserve {
+		v.preserve(&encoding{info: Indefinite, chunks: chunks})
+	}
+	return v, nil
+}
+
+func (v *Value) preserve(enc *encoding) {
+	if v.kind == KindMap {
+		v.dict.enc = enc
+	} else {
+		v.enc = enc
+	}
+}
+
+// decodeEntry decodes the next element of an array or entry of a map given
+// the header h of the element or of the key starting at off.
+func decodeEntry(d *Decoder, v *Value, h Header, off int64) error {
+	e, err := decodeItem(d, h, off)
+	if err != nil {
+		if v.kind != KindMap {
+			err = atPath(err, indexSegment(len(v.items)))
+		}
+		return err
+	}
+	if v.kind != KindMap {
+		v.items = append(v.items, e)
+		return nil
+	}
+	if _, ok := v.dict.index[keyOf(e)]; ok {
+		return &DuplicateKeyError{Key: e.String(), Offset: off, Path: valueSegment(e)}
+	}
+	x, err := decodeValue(d)
+	if err != nil {
+		return atPath(err, valueSegment(e))
+	}
+	v.dict.set(e, x)
+	return nil
+}
+
+func decodeText(d *Decoder, m byte, bs []byte, off int64) (Value, error) {
+	if m == Bin {
+		return NewBytes(bs), nil
+	}
+	if !utf8.Valid(bs) {
+		if d.utf8 != UTF8Replace {
+			return Value{}, &InvalidUTF8Error{Offset: off}
+		}
+		bs = bytes.ToValidUTF8(bs, []byte(string(utf8.RuneError)))
+	}
+	return Value{kind: KindText, bytes: bs}, nil
+}
+
+// valueSegment returns the segment of the path of the value of the key k of
+// a map.
+func valueSegment(k Value) string {
+	if k.kind == KindText {
+		return "." + string(k.bytes)
+	}
+	return "[" + k.String() + "]"
+}
+
+// kindOf returns the kind of an item given its major type m and additional
+// information a.
+func kindOf(m, a byte) Kind {
+	switch m {
+	case Uint:
+		return KindUint
+	case Int:
+		return KindInt
+	case Bin:
+		return KindBytes
+	case String:
+		return KindText
+	case Array:
+		return KindArray
+	case Map:
+		return KindMap
+	case Tag:
+		return KindTag
+	}
+	switch a {
+	case False, True:
+		return KindBool
+	case Nil:
+		return KindNull
+	case Undefined:
+		return KindUndefined
+	case Float16, Float32, Float64:
+		return KindFloat
+	default:
+		return KindSimple
+	}
+}
+
+func decodeSimple(a byte, arg uint64) Value {
+	switch a {
+	case False, True:
+		return NewBool(a == True)
+	case Nil:
+		return NewNull()
+	case Undefined:
+		return NewUndefined()
+	case Float16:
+		return NewFloat(float16frombits(uint16(arg)))
+	case Float32:
+		return NewFloat(float64(math.Float32frombits(uint32(arg))))
+	case Float64:
+		return NewFloat(math.Float64frombits(arg))
+	default:
+		return NewSimple(byte(arg))
+	}
+}
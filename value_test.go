@@ -0,0 +1,195 @@
+package cbor
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+)
+
+func TestValueRoundTrip(t *testing.T) {
+	data := []struct {
+		Raw  string
+		Kind Kind
+		Want string
+	}{
+		{Raw: "1903e8", Kind: KindUint},
+		{Raw: "3903e7", Kind: KindInt},
+		{Raw: "4401020304", Kind: KindBytes},
+		{Raw: "6449455446", Kind: KindText},
+		{Raw: "5f42010243030405ff", Kind: KindBytes, Want: "450102030405"},
+		{Raw: "7f657374726561646d696e67ff", Kind: KindText, Want: "6973747265616d696e67"},
+		{Raw: "83010203", Kind: KindArray},
+		{Raw: "9f018202039f0405ffff", Kind: KindArray, Want: "8301820203820405"},
+		{Raw: "a26161016162820203", Kind: KindMap},
+		{Raw: "a2616201616102", Kind: KindMap},
+		{Raw: "bf61610161629f0203ffff", Kind: KindMap, Want: "a26161016162820203"},
+		{Raw: "c11a514b67b0", Kind: KindTag},
+		{Raw: "f5", Kind: KindBool},
+		{Raw: "f4", Kind: KindBool},
+		{Raw: "f6", Kind: KindNull},
+		{Raw: "f7", Kind: KindUndefined},
+		{Raw: "f0", Kind: KindSimple},
+		{Raw: "f8ff", Kind: KindSimple},
+		{Raw: "f93e00", Kind: KindFloat},
+		{Raw: "fa47c35000", Kind: KindFloat},
+		{Raw: "fb3ff199999999999a", Kind: KindFloat},
+	}
+	for i, d := range data {
+		var v Value
+		if err := decodeAndUnmarshal(d.Raw, &v); err != nil {
+			t.Errorf("%d: unmarshal fail: %v", i+1, err)
+			continue
+		}
+		if v.Kind() != d.Kind {
+			t.Errorf("%d: kind mismatched: want %s, got %s", i+1, d.Kind, v.Kind())
+		}
+		bs, err := Marshal(v)
+		if err != nil {
+			t.Errorf("%d: marshal fail: %v", i+1, err)
+			continue
+		}
+		want := d.Want
+		if want == "" {
+			want = d.Raw
+		}
+		if got := hex.EncodeToString(bs); got != want {
+			t.Errorf("%d: want %s, got %s", i+1, want, got)
+		}
+	}
+}
+
+func TestValueAccessors(t *testing.T) {
+	var v Value
+	if err := decodeAndUnmarshal("a3616101616282f93e0063666f6f0ac11a514b67b0", &v); err != nil {
+		t.Fatalf("unmarshal fail: %v", err)
+	}
+	a, ok := v.Get("a")
+	if !ok {
+		t.Fatalf("key a not found")
+	}
+	if i, err := a.Int(); err != nil || i != 1 {
+		t.Errorf("a: want 1, got %d (%v)", i, err)
+	}
+	if _, err := a.Text(); err == nil {
+		t.Errorf("a: expected error when reading uint as text")
+	}
+	b, _ := v.Get(NewText("b"))
+	if b.Len() != 2 {
+		t.Errorf("b: want 2 elements, got %d", b.Len())
+	}
+	e, err := b.Index(0)
+	if f, _ := e.Float(); err != nil || f != 1.5 {
+		t.Errorf("b[0]: want 1.5, got %f (%v)", f, err)
+	}
+	e, _ = b.Index(1)
+	if s, _ := e.Text(); s != "foo" {
+		t.Errorf("b[1]: want foo, got %s", s)
+	}
+	if _, err := b.Index(2); err == nil {
+		t.Errorf("b[2]: expected out of range error")
+	}
+	c, ok := v.Get(10)
+	if !ok {
+		t.Fatalf("key 10 not found")
+	}
+	tag, x, err := c.Tag()
+	if u, _ := x.Uint(); err != nil || tag != TagUnix || u != 1363896240 {
+		t.Errorf("10: unexpected tag %d(%d) (%v)", tag, u, err)
+	}
+	if _, ok := v.Get("c"); ok {
+		t.Errorf("key c should not be found")
+	}
+}
+
+func TestValueBuilders(t *testing.T) {
+	m := NewMap()
+	if err := m.Set("b", []int{1}); err != nil {
+		t.Fatalf("set fail: %v", err)
+	}
+	if err := m.Set("a", NewTag(TagURI, NewText("http://x"))); err != nil {
+		t.Fatalf("set fail: %v", err)
+	}
+	arr := NewArray(NewBool(true), NewNull())
+	if err := arr.Append(-2, NewBytes([]byte{0xff}), 1.5); err != nil {
+		t.Fatalf("append fail: %v", err)
+	}
+	m.Set("b", arr)
+	if err := arr.Set("x", 1); err == nil {
+		t.Errorf("expected error when setting key on array")
+	}
+	want := `{"b": [true, null, -2, h'ff', 1.5], "a": 32("http://x")}`
+	if got := m.String(); got != want {
+		t.Errorf("want %s, got %s", want, got)
+	}
+}
+
+func TestValuePreserveEncoding(t *testing.T) {
+	data := []string{
+		"1818",
+		"1800",
+		"190018",
+		"1b0000000000000001",
+		"3a00000001",
+		"5f42010243030405ff",
+		"5f5800ff",
+		"7f657374726561646d696e67ff",
+		"780161",
+		"9f018202039f0405ffff",
+		"9803010203",
+		"b9000161610a",
+		"bf61610161629f0203ffff",
+		"d80101",
+		"f8ff",
+		"fa3fc00000",
+		"fb3ff8000000000000",
+		"f97e01",
+		"a2f93c00fa3f8000001a00000001fb3ff0000000000000",
+	}
+	for i, d := range data {
+		raw, _ := hex.DecodeString(d)
+		var (
+			v   Value
+			dec = NewDecoder(bytes.NewReader(raw))
+		)
+		dec.PreserveEncoding(true)
+		if err := dec.Decode(&v); err != nil {
+			t.Errorf("%d: unmarshal fail: %v", i+1, err)
+			continue
+		}
+		bs, err := Marshal(v)
+		if err != nil {
+			t.Errorf("%d: marshal fail: %v", i+1, err)
+			continue
+		}
+		if !bytes.Equal(bs, raw) {
+			t.Errorf("%d: want %s, got %x", i+1, d, bs)
+		}
+	}
+}
+
+func TestValuePreserveModified(t *testing.T) {
+	raw, _ := hex.DecodeString("bf61611818617a5f41014102ff6162980101ff")
+	var (
+		v   Value
+		dec = NewDecoder(bytes.NewReader(raw))
+	)
+	dec.PreserveEncoding(true)
+	if err := dec.Decode(&v); err != nil {
+		t.Fatalf("unmarshal fail: %v", err)
+	}
+	if x, ok := v.Get(24); ok {
+		t.Errorf("unexpected key 24: %s", x)
+	}
+	b, _ := v.Get("b")
+	b.Append(2)
+	v.Set("b", b)
+	v.Set("a", 1000)
+	bs, err := Marshal(v)
+	if err != nil {
+		t.Fatalf("marshal fail: %v", err)
+	}
+	want := "bf61611903e8617a5f41014102ff616298020102ff"
+	if got := hex.EncodeToString(bs); got != want {
+		t.Errorf("want %s, got %s", want, got)
+	}
+}
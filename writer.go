@@ -0,0 +1,145 @@
+package cbor
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+)
+
+// The Write methods of an Encoder write a single header or data item to its
+// output. Containers are written as a header giving their length followed by
+// their elements, or as an indefinite length header followed by their
+// elements and a break code.
+
+func (e *Encoder) WriteUint(v uint64) error {
+	return e.writeHeader(Uint, v)
+}
+
+// WriteNegInt writes the negative integer -1-n.
+func (e *Encoder) WriteNegInt(n uint64) error {
+	return e.writeHeader(Int, n)
+}
+
+// WriteInt writes v as an unsigned or a negative integer.
+func (e *Encoder) WriteInt(v int64) error {
+	if v < 0 {
+		return e.WriteNegInt(uint64(-1 - v))
+	}
+	return e.WriteUint(uint64(v))
+}
+
+func (e *Encoder) WriteBytes(bs []byte) error {
+	if err := e.writeHeader(Bin, uint64(len(bs))); err != nil {
+		return err
+	}
+	_, err := e.w.Write(bs)
+	return err
+}
+
+// WriteText writes s as a text string. Invalid UTF-8 sequences are replaced
+// with U+FFFD with UTF8Replace; otherwise they make WriteText fail with
+// ErrInvalidUTF8.
+func (e *Encoder) WriteText(s string) error {
+	if !utf8.ValidString(s) {
+		if e.utf8 != UTF8Replace {
+			return ErrInvalidUTF8
+		}
+		s = strings.ToValidUTF8(s, string(utf8.RuneError))
+	}
+	if err := e.writeHeader(String, uint64(len(s))); err != nil {
+		return err
+	}
+	_, err := io.WriteString(e.w, s)
+	return err
+}
+
+// WriteArrayHeader writes the header of an array of n elements.
+func (e *Encoder) WriteArrayHeader(n uint64) error {
+	return e.writeHeader(Array, n)
+}
+
+// WriteMapHeader writes the header of a map of n entries.
+func (e *Encoder) WriteMapHeader(n uint64) error {
+	return e.writeHeader(Map, n)
+}
+
+// WriteIndefinite writes the header of an indefinite length item of major
+// type m: Bin, String, Array or Map. It must be followed by the chunks or
+// the elements of the item and by WriteBreak.
+func (e *Encoder) WriteIndefinite(m byte) error {
+	switch m {
+	case Bin, String, Array, Map:
+	default:
+		return fmt.Errorf("cbor: indefinite length not allowed for major type %d", m>>5)
+	}
+	return e.write(m | Indefinite)
+}
+
+func (e *Encoder) WriteBreak() error {
+	return e.write(Break)
+}
+
+// WriteTag writes the number of a tag. It must be followed by its content.
+func (e *Encoder) WriteTag(n uint64) error {
+	return e.writeHeader(Tag, n)
+}
+
+// WriteSimple writes the simple value v. The values 24 to 31 are reserved
+// and can not be written.
+func (e *Encoder) WriteSimple(v byte) error {
+	if v >= Simple && v < 32 {
+		return fmt.Errorf("cbor: invalid simple value %d", v)
+	}
+	return e.writeHeader(Other, uint64(v))
+}
+
+func (e *Encoder) WriteBool(v bool) error {
+	if v {
+		return e.write(Other | True)
+	}
+	return e.write(Other | False)
+}
+
+func (e *Encoder) WriteNull() error {
+	return e.write(Other | Nil)
+}
+
+func (e *Encoder) WriteUndefined() error {
+	return e.write(Other | Undefined)
+}
+
+// WriteFloat16 writes f as a half precision float. Values that can not be
+// represented are rounded toward zero or written as an infinity.
+func (e *Encoder) WriteFloat16(f float32) error {
+	return e.writeFloat(float64(f), Float16)
+}
+
+func (e *Encoder) WriteFloat32(f float32) error {
+	return e.writeFloat(float64(f), Float32)
+}
+
+func (e *Encoder) WriteFloat64(f float64) error {
+	return e.writeFloat(f, Float64)
+}
+
+// WriteFloat writes f as the shortest float that holds its value.
+func (e *Encoder) WriteFloat(f float64) error {
+	return e.writeFloat(f, floatSize(f))
+}
+
+func (e *Encoder) writeFloat(f float64, a byte) error {
+	_, err := e.w.Write(appendFloat(e.scratch[:0], f, a))
+	return err
+}
+
+func (e *Encoder) writeHeader(m byte, v uint64) error {
+	_, err := e.w.Write(appendHeader(e.scratch[:0], m, infoOf(v), v))
+	return err
+}
+
+func (e *Encoder) write(b byte) error {
+	e.scratch[0] = b
+	_, err := e.w.Write(e.scratch[:1])
+	return err
+}
@@ -0,0 +1,110 @@
+package cbor
+
+import (
+	"bytes"
+	"encoding/hex"
+	"io"
+	"math"
+	"testing"
+)
+
+func TestEncoderWrite(t *testing.T) {
+	data := []struct {
+		Write func(e *Encoder) error
+		Want  string
+	}{
+		{Write: func(e *Encoder) error { return e.WriteUint(0) }, Want: "00"},
+		{Write: func(e *Encoder) error { return e.WriteUint(24) }, Want: "1818"},
+		{Write: func(e *Encoder) error { return e.WriteUint(math.MaxUint64) }, Want: "1bffffffffffffffff"},
+		{Write: func(e *Encoder) error { return e.WriteNegInt(99) }, Want: "3863"},
+		{Write: func(e *Encoder) error { return e.WriteInt(-1000) }, Want: "3903e7"},
+		{Write: func(e *Encoder) error { return e.WriteInt(1000) }, Want: "1903e8"},
+		{Write: func(e *Encoder) error { return e.WriteBytes([]byte{1, 2, 3, 4}) }, Want: "4401020304"},
+		{Write: func(e *Encoder) error { return e.WriteText("IETF") }, Want: "6449455446"},
+		{Write: func(e *Encoder) error { return e.WriteText("") }, Want: "60"},
+		{Write: func(e *Encoder) error { return e.WriteArrayHeader(25) }, Want: "9819"},
+		{Write: func(e *Encoder) error { return e.WriteMapHeader(2) }, Want: "a2"},
+		{Write: func(e *Encoder) error { return e.WriteTag(32) }, Want: "d820"},
+		{Write: func(e *Encoder) error { return e.WriteSimple(16) }, Want: "f0"},
+		{Write: func(e *Encoder) error { return e.WriteSimple(255) }, Want: "f8ff"},
+		{Write: func(e *Encoder) error { return e.WriteBool(true) }, Want: "f5"},
+		{Write: func(e *Encoder) error { return e.WriteBool(false) }, Want: "f4"},
+		{Write: func(e *Encoder) error { return e.WriteNull() }, Want: "f6"},
+		{Write: func(e *Encoder) error { return e.WriteUndefined() }, Want: "f7"},
+		{Write: func(e *Encoder) error { return e.WriteFloat16(1.5) }, Want: "f93e00"},
+		{Write: func(e *Encoder) error { return e.WriteFloat16(float32(math.Inf(-1))) }, Want: "f9fc00"},
+		{Write: func(e *Encoder) error { return e.WriteFloat32(100000) }, Want: "fa47c35000"},
+		{Write: func(e *Encoder) error { return e.WriteFloat64(1.1) }, Want: "fb3ff199999999999a"},
+		{Write: func(e *Encoder) error { return e.WriteFloat(65504) }, Want: "f97bff"},
+		{Write: func(e *Encoder) error { return e.WriteFloat(math.NaN()) }, Want: "f97e00"},
+		{Write: func(e *Encoder) error { return e.WriteIndefinite(Array) }, Want: "9f"},
+		{Write: func(e *Encoder) error { return e.WriteBreak() }, Want: "ff"},
+	}
+	for i, d := range data {
+		var buf bytes.Buffer
+		if err := d.Write(NewEncoder(&buf)); err != nil {
+			t.Errorf("%d: unexpected error: %s", i+1, err)
+			continue
+		}
+		if got := hex.EncodeToString(buf.Bytes()); got != d.Want {
+			t.Errorf("%d: want %s, got %s", i+1, d.Want, got)
+		}
+	}
+}
+
+func TestEncoderWriteDocument(t *testing.T) {
+	var (
+		buf bytes.Buffer
+		e   = NewEncoder(&buf)
+	)
+	e.WriteMapHeader(2)
+	e.WriteText("a")
+	e.WriteIndefinite(Array)
+	e.WriteTag(TagUnix)
+	e.WriteUint(1363896240)
+	e.WriteIndefinite(String)
+	e.WriteText("str")
+	e.WriteText("eam")
+	e.WriteBreak()
+	e.WriteBreak()
+	e.WriteText("b")
+	e.WriteNull()
+
+	want := mustParse(t, `{"a": [_ 1(1363896240), (_ "str", "eam")], "b": null}`)
+	if !bytes.Equal(buf.Bytes(), want) {
+		t.Errorf("want %x, got %x", want, buf.Bytes())
+	}
+}
+
+func TestEncoderWriteErrors(t *testing.T) {
+	e := NewEncoder(io.Discard)
+	if err := e.WriteSimple(24); err == nil {
+		t.Errorf("expected error for reserved simple value")
+	}
+	if err := e.WriteIndefinite(Uint); err == nil {
+		t.Errorf("expected error for indefinite uint")
+	}
+	if err := e.WriteText("\xff"); err != ErrInvalidUTF8 {
+		t.Errorf("expected ErrInvalidUTF8, got %v", err)
+	}
+	var buf bytes.Buffer
+	e = NewEncoder(&buf)
+	e.SetUTF8Policy(UTF8Replace)
+	if err := e.WriteText("a\xff"); err != nil || hex.EncodeToString(buf.Bytes()) != "6461efbfbd" {
+		t.Errorf("unexpected result: %x (%v)", buf.Bytes(), err)
+	}
+}
+
+func TestEncoderWriteAllocs(t *testing.T) {
+	e := NewEncoder(io.Discard)
+	n := testing.AllocsPerRun(100, func() {
+		e.WriteArrayHeader(3)
+		e.WriteUint(1 << 40)
+		e.WriteNegInt(1000)
+		e.WriteFloat64(1.1)
+		e.WriteText("text")
+	})
+	if n != 0 {
+		t.Errorf("write methods allocate %f times", n)
+	}
+}